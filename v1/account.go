@@ -0,0 +1,207 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ManagedAccount is a Shippo account that is managed by a Shippo
+// Platform account, typically that of a merchant being shipped
+// for. Calls are made on its behalf by passing the context
+// returned by WithManagedAccount to the ...Context methods.
+type ManagedAccount struct {
+	// ID is an output only variable created by GoShippo's backend.
+	ID string `json:"object_id,omitempty"`
+
+	// Date and time of ManagedAccount creation.
+	CreatedAt *time.Time `json:"object_created,omitempty"`
+
+	// Date and time of the last ManagedAccount update.
+	UpdatedAt *time.Time `json:"object_updated,omitempty"`
+
+	// Email is the email address of the account holder.
+	// It is required.
+	Email string `json:"email"`
+
+	// FirstName is required.
+	FirstName string `json:"first_name"`
+
+	// LastName is required.
+	LastName string `json:"last_name"`
+
+	// CompanyName is required.
+	CompanyName string `json:"company_name"`
+}
+
+var (
+	errBlankAccountEmail       = errors.New("expecting a non-blank email")
+	errBlankAccountFirstName   = errors.New("expecting a non-blank first name")
+	errBlankAccountLastName    = errors.New("expecting a non-blank last name")
+	errBlankAccountCompanyName = errors.New("expecting a non-blank company name")
+
+	errEmptyAccountID = errors.New("expecting a non-empty accountID")
+
+	errBlankAccountFromServer = errors.New("got back a blank managed account from the server")
+)
+
+func (acct *ManagedAccount) Validate() error {
+	switch {
+	case acct == nil || strings.TrimSpace(acct.Email) == "":
+		return errBlankAccountEmail
+	case strings.TrimSpace(acct.FirstName) == "":
+		return errBlankAccountFirstName
+	case strings.TrimSpace(acct.LastName) == "":
+		return errBlankAccountLastName
+	case strings.TrimSpace(acct.CompanyName) == "":
+		return errBlankAccountCompanyName
+	default:
+		return nil
+	}
+}
+
+var blankManagedAccount ManagedAccount
+
+// WithManagedAccount returns a context that makes the calls it is
+// passed to act on behalf of the managed account with accountID.
+// Any Tenant that ctx already has keeps its API key and ID.
+func WithManagedAccount(ctx context.Context, accountID string) context.Context {
+	tenant, _ := TenantFromContext(ctx)
+	tenant.AccountID = accountID
+	return WithTenant(ctx, tenant)
+}
+
+func (c *Client) CreateManagedAccount(acct *ManagedAccount) (*ManagedAccount, error) {
+	return c.CreateManagedAccountContext(context.Background(), acct)
+}
+
+func (c *Client) CreateManagedAccountContext(ctx context.Context, acct *ManagedAccount) (_ *ManagedAccount, err error) {
+	ctx, endOp := startOp(ctx, "CreateManagedAccount", EndpointAccounts)
+	defer func() { endOp(err) }()
+
+	return invoke(c, ctx, &Operation{Name: "CreateManagedAccount", Class: EndpointAccounts, Request: acct}, func(ctx context.Context) (*ManagedAccount, error) {
+		if err := acct.Validate(); err != nil {
+			return nil, err
+		}
+
+		key, replayedID, err := c.replayedID(ctx, EndpointAccounts)
+		if err != nil {
+			return nil, err
+		}
+		if replayedID != "" {
+			return c.ManagedAccountByIDContext(ctx, replayedID)
+		}
+
+		blob, err := json.Marshal(acct)
+		if err != nil {
+			return nil, err
+		}
+		fullURL := fmt.Sprintf("%s/shippo-accounts/", c.baseURL())
+		req, err := http.NewRequestWithContext(ctx, "POST", fullURL, bytes.NewReader(blob))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(idempotencyKeyHeader, key)
+
+		recvAcct, err := c.doReqAndManagedAccount(req)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.recordCreated(ctx, EndpointAccounts, key, recvAcct.ID); err != nil {
+			return recvAcct, err
+		}
+		return recvAcct, nil
+	})
+}
+
+func (c *Client) ManagedAccountByID(accountID string) (*ManagedAccount, error) {
+	return c.ManagedAccountByIDContext(context.Background(), accountID)
+}
+
+func (c *Client) ManagedAccountByIDContext(ctx context.Context, accountID string) (_ *ManagedAccount, err error) {
+	ctx, endOp := startOp(ctx, "ManagedAccountByID", EndpointAccounts)
+	defer func() { endOp(err) }()
+
+	return invoke(c, ctx, &Operation{Name: "ManagedAccountByID", Class: EndpointAccounts, Request: accountID}, func(ctx context.Context) (*ManagedAccount, error) {
+		accountID = strings.TrimSpace(accountID)
+		if accountID == "" {
+			return nil, errEmptyAccountID
+		}
+		fullURL := fmt.Sprintf("%s/shippo-accounts/%s/", c.baseURL(), accountID)
+		req, err := http.NewRequestWithContext(ctx, "GET", fullURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		return c.doReqAndManagedAccount(req)
+	})
+}
+
+// UpdateManagedAccount replaces the details of the managed
+// account with acct.ID by those of acct, all of which are required.
+func (c *Client) UpdateManagedAccount(acct *ManagedAccount) (*ManagedAccount, error) {
+	return c.UpdateManagedAccountContext(context.Background(), acct)
+}
+
+func (c *Client) UpdateManagedAccountContext(ctx context.Context, acct *ManagedAccount) (_ *ManagedAccount, err error) {
+	ctx, endOp := startOp(ctx, "UpdateManagedAccount", EndpointAccounts)
+	defer func() { endOp(err) }()
+
+	return invoke(c, ctx, &Operation{Name: "UpdateManagedAccount", Class: EndpointAccounts, Request: acct}, func(ctx context.Context) (*ManagedAccount, error) {
+		if err := acct.Validate(); err != nil {
+			return nil, err
+		}
+		accountID := strings.TrimSpace(acct.ID)
+		if accountID == "" {
+			return nil, errEmptyAccountID
+		}
+
+		blob, err := json.Marshal(acct)
+		if err != nil {
+			return nil, err
+		}
+		fullURL := fmt.Sprintf("%s/shippo-accounts/%s/", c.baseURL(), accountID)
+		req, err := http.NewRequestWithContext(ctx, "PUT", fullURL, bytes.NewReader(blob))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return c.doReqAndManagedAccount(req)
+	})
+}
+
+// NewManagedAccountPager returns a Pager over the
+// accounts managed by the client's Platform account.
+func (c *Client) NewManagedAccountPager(alReq *ListRequest) (*Pager[*ManagedAccount], error) {
+	return newPager[*ManagedAccount](c, "ListManagedAccounts", EndpointAccounts, "shippo-accounts", alReq)
+}
+
+func (c *Client) doReqAndManagedAccount(req *http.Request) (*ManagedAccount, error) {
+	recvAcct := new(ManagedAccount)
+	if _, err := c.doAuthAndReq(req, recvAcct); err != nil {
+		return nil, err
+	}
+	if *recvAcct == blankManagedAccount {
+		return nil, errBlankAccountFromServer
+	}
+	return recvAcct, nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/orijtech/goshippo/v1"
+)
+
+const accountID1 = "1e2a2dd3df3a4b5e9c7fd4b0b1f6f4e2"
+
+func managedAccountRoundTrip(req *http.Request) (*http.Response, error) {
+	if res, err := checkBadAuth(req, req.Method); res != nil || err != nil {
+		return res, err
+	}
+	route := fmt.Sprintf("%s %s", req.Method, req.URL.Path)
+	var acct goshippo.ManagedAccount
+	switch route {
+	case "POST /shippo-accounts/", "PUT /shippo-accounts/" + accountID1 + "/":
+		slurp, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return makeResp(err.Error(), http.StatusBadRequest), nil
+		}
+		if err := json.Unmarshal(slurp, &acct); err != nil {
+			return makeResp(err.Error(), http.StatusBadRequest), nil
+		}
+	case "GET /shippo-accounts/" + accountID1 + "/":
+		acct = goshippo.ManagedAccount{Email: "hippo@example.org", FirstName: "Shippo", LastName: "Meister", CompanyName: "Acme"}
+	default:
+		return makeResp(fmt.Sprintf("%q unknown route", route), http.StatusNotFound), nil
+	}
+	acct.ID = accountID1
+	blob, _ := json.Marshal(acct)
+	res := makeResp("200 OK", http.StatusOK)
+	res.Body = ioutil.NopCloser(strings.NewReader(string(blob)))
+	return res, nil
+}
+
+func TestManagedAccounts(t *testing.T) {
+	client, err := goshippo.NewClient(token1)
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	client.SetHTTPRoundTripper(roundTripperFunc(managedAccountRoundTrip))
+
+	valid := &goshippo.ManagedAccount{Email: "hippo@example.org", FirstName: "Shippo", LastName: "Meister", CompanyName: "Acme"}
+
+	tests := [...]struct {
+		acct    *goshippo.ManagedAccount
+		update  bool
+		wantErr bool
+	}{
+		0: {acct: nil, wantErr: true},
+		1: {acct: &goshippo.ManagedAccount{FirstName: "Shippo", LastName: "Meister", CompanyName: "Acme"}, wantErr: true},
+		2: {acct: &goshippo.ManagedAccount{Email: "hippo@example.org", FirstName: "Shippo", LastName: "Meister"}, wantErr: true},
+		3: {acct: valid},
+		4: {acct: valid, update: true, wantErr: true},
+		5: {acct: &goshippo.ManagedAccount{ID: accountID1, Email: "hippo@example.org", FirstName: "Shippo", LastName: "Meister", CompanyName: "Acme Inc"}, update: true},
+	}
+
+	for i, tt := range tests {
+		var got *goshippo.ManagedAccount
+		var err error
+		if tt.update {
+			got, err = client.UpdateManagedAccount(tt.acct)
+		} else {
+			got, err = client.CreateManagedAccount(tt.acct)
+		}
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("#%d: expected a non-nil error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: gotErr=%v", i, err)
+			continue
+		}
+		if got.ID != accountID1 || got.CompanyName != tt.acct.CompanyName {
+			t.Errorf("#%d: got=%+v", i, got)
+		}
+	}
+
+	if _, err := client.ManagedAccountByID(" "); err == nil {
+		t.Error("expected an error for a blank accountID")
+	}
+	got, err := client.ManagedAccountByID(accountID1)
+	if err != nil {
+		t.Fatalf("managedAccountByID err: %v", err)
+	}
+	if got.ID != accountID1 || got.Email != "hippo@example.org" {
+		t.Errorf("got=%+v", got)
+	}
+}
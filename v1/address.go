@@ -16,22 +16,28 @@ package goshippo
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
-	"net/url"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/orijtech/otils"
 )
 
 type Address struct {
-	// Purpose is required for creating addresses.
+	// Purpose is required for creating addresses with API
+	// versions before 2017-03-29 and with unpinned clients.
+	// It is not sent to the backend for later versions.
 	Purpose string `json:"object_purpose,omitempty"`
 
+	// ObjectState is an output only variable that legacy API
+	// versions set to "VALID" or "INVALID" after validation.
+	// Later versions report ValidationResults instead.
+	ObjectState string `json:"object_state,omitempty"`
+
 	// Complete is an output only variable that
 	// is set only when the address contains
 	// all the required values.
@@ -137,6 +143,7 @@ type Address struct {
 
 var (
 	errBlankPurpose = errors.New("purpose is required")
+	errBlankCountry = errors.New("country is required")
 
 	errAlreadyClosed = errors.New("already closed channel")
 
@@ -145,72 +152,146 @@ var (
 	errBlankAddressReceived = errors.New("received a blank address from the backend")
 )
 
+// Validate checks addr against the requirements of legacy API
+// versions, which require Purpose. Use ValidateForVersion for
+// clients that are pinned to a specific API version.
 func (addr *Address) Validate() error {
-	if addr == nil || strings.TrimSpace(addr.Purpose) == "" {
-		return errBlankPurpose
+	return addr.ValidateForVersion(APIVersionUnpinned)
+}
+
+func (addr *Address) ValidateForVersion(version APIVersion) error {
+	if version.usesObjectPurpose() {
+		if addr == nil || strings.TrimSpace(addr.Purpose) == "" {
+			return errBlankPurpose
+		}
+		return nil
+	}
+	if addr == nil || strings.TrimSpace(addr.Country) == "" {
+		return errBlankCountry
 	}
 	return nil
 }
 
+// forVersion returns the representation of addr
+// that should be sent to a backend using version.
+func (addr *Address) forVersion(version APIVersion) *Address {
+	if version.usesObjectPurpose() || addr.Purpose == "" {
+		return addr
+	}
+	stripped := *addr
+	stripped.Purpose = ""
+	return &stripped
+}
+
+// normalize fills in the fields that the backend's
+// version didn't send from the ones that it did.
+func (addr *Address) normalize() {
+	if addr.ValidationResults == nil && addr.ObjectState != "" {
+		addr.ValidationResults = &ValidationResult{Valid: strings.EqualFold(addr.ObjectState, "VALID")}
+	}
+}
+
 var blankAddress Address
 
 func (c *Client) CreateAddress(addr *Address) (*Address, error) {
-	if err := addr.Validate(); err != nil {
-		return nil, err
-	}
+	return c.CreateAddressContext(context.Background(), addr)
+}
 
-	blob, err := json.Marshal(addr)
-	if err != nil {
-		return nil, err
-	}
-	fullURL := fmt.Sprintf("%s/addresses/", baseURL)
-	req, err := http.NewRequest("POST", fullURL, bytes.NewReader(blob))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	return c.doReqAndAddressByID(req)
+func (c *Client) CreateAddressContext(ctx context.Context, addr *Address) (_ *Address, err error) {
+	ctx, endOp := startOp(ctx, "CreateAddress", EndpointAddresses)
+	defer func() { endOp(err) }()
+
+	return invoke(c, ctx, &Operation{Name: "CreateAddress", Class: EndpointAddresses, Request: addr}, func(ctx context.Context) (*Address, error) {
+		version := c.APIVersion()
+		if err := addr.ValidateForVersion(version); err != nil {
+			return nil, err
+		}
+
+		key, replayedID, err := c.replayedID(ctx, EndpointAddresses)
+		if err != nil {
+			return nil, err
+		}
+		if replayedID != "" {
+			return c.AddressByIDContext(ctx, replayedID)
+		}
+
+		blob, err := json.Marshal(addr.forVersion(version))
+		if err != nil {
+			return nil, err
+		}
+		fullURL := fmt.Sprintf("%s/addresses/", c.baseURL())
+		req, err := http.NewRequestWithContext(ctx, "POST", fullURL, bytes.NewReader(blob))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(idempotencyKeyHeader, key)
+		recvAddr, err := c.doReqAndAddressByID(req)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.recordCreated(ctx, EndpointAddresses, key, recvAddr.ID); err != nil {
+			return recvAddr, err
+		}
+		return recvAddr, nil
+	})
 }
 
 func (c *Client) doReqAndAddressByID(req *http.Request) (*Address, error) {
-	blob, _, err := c.doAuthAndReq(req)
-	if err != nil {
-		return nil, err
-	}
 	recvAddr := new(Address)
-	if err := json.Unmarshal(blob, recvAddr); err != nil {
+	if _, err := c.doAuthAndReq(req, recvAddr); err != nil {
 		return nil, err
 	}
 	if *recvAddr == blankAddress {
 		return nil, errBlankAddressReceived
 	}
+	recvAddr.normalize()
+	c.RecordObjectMode(recvAddr.ID, modeOfTestFlag(recvAddr.InTestMode))
 	return recvAddr, nil
 }
 
 func (c *Client) AddressByID(addressID string) (*Address, error) {
-	addressID = strings.TrimSpace(addressID)
-	if addressID == "" {
-		return nil, errEmptyAddressID
-	}
-	fullURL := fmt.Sprintf("%s/addresses/%s/", baseURL, addressID)
-	req, err := http.NewRequest("GET", fullURL, nil)
-	if err != nil {
-		return nil, err
-	}
-	return c.doReqAndAddressByID(req)
+	return c.AddressByIDContext(context.Background(), addressID)
+}
+
+func (c *Client) AddressByIDContext(ctx context.Context, addressID string) (_ *Address, err error) {
+	ctx, endOp := startOp(ctx, "AddressByID", EndpointAddresses)
+	defer func() { endOp(err) }()
+
+	return invoke(c, ctx, &Operation{Name: "AddressByID", Class: EndpointAddresses, Request: addressID}, func(ctx context.Context) (*Address, error) {
+		addressID = strings.TrimSpace(addressID)
+		if addressID == "" {
+			return nil, errEmptyAddressID
+		}
+		fullURL := fmt.Sprintf("%s/addresses/%s/", c.baseURL(), addressID)
+		req, err := http.NewRequestWithContext(ctx, "GET", fullURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		return c.doReqAndAddressByID(req)
+	})
 }
 
 func (c *Client) ValidateAddress(addressID string) (*Address, error) {
-	addressID = strings.TrimSpace(addressID)
-	if addressID == "" {
-		return nil, errEmptyAddressID
-	}
-	fullURL := fmt.Sprintf("%s/addresses/%s/validate/", baseURL, addressID)
-	req, err := http.NewRequest("GET", fullURL, nil)
-	if err != nil {
-		return nil, err
-	}
-	return c.doReqAndAddressByID(req)
+	return c.ValidateAddressContext(context.Background(), addressID)
+}
+
+func (c *Client) ValidateAddressContext(ctx context.Context, addressID string) (_ *Address, err error) {
+	ctx, endOp := startOp(ctx, "ValidateAddress", EndpointAddresses)
+	defer func() { endOp(err) }()
+
+	return invoke(c, ctx, &Operation{Name: "ValidateAddress", Class: EndpointAddresses, Request: addressID}, func(ctx context.Context) (*Address, error) {
+		addressID = strings.TrimSpace(addressID)
+		if addressID == "" {
+			return nil, errEmptyAddressID
+		}
+		fullURL := fmt.Sprintf("%s/addresses/%s/validate/", c.baseURL(), addressID)
+		req, err := http.NewRequestWithContext(ctx, "GET", fullURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		return c.doReqAndAddressByID(req)
+	})
 }
 
 type AddressPage struct {
@@ -218,6 +299,10 @@ type AddressPage struct {
 	Addresses  []*Address `json:"addresses"`
 	Err        error
 
+	// Count is the total number of addresses
+	// that the backend reports for the list.
+	Count uint64 `json:"count"`
+
 	PreviousToken string `json:"previous_token"`
 	NextToken     string `json:"next_token"`
 }
@@ -227,167 +312,53 @@ type AddressesPager struct {
 	Cancel func() error
 }
 
-func makeCanceler() (func() error, <-chan bool) {
-	var closeOnce sync.Once
-	cancelChan := make(chan bool)
-	closeFn := func() error {
-		var err error = errAlreadyClosed
-		closeOnce.Do(func() {
-			close(cancelChan)
-			err = nil
-		})
-		return err
-	}
-	return closeFn, cancelChan
-}
-
-const (
-	NoThrottle = -1
-)
-
-type AddressListRequest struct {
-	MaxPages     uint64 `json:"max_pages"`
-	LimitPerPage uint64 `json:"limit_per_page"`
-	PageToken    string `json:"page_token"`
-	PageNumber   uint64 `json:"page_number"`
-
-	ThrottleDurationMs int64 `json:"throttle_duration_ms"`
-}
-
-type pager struct {
-	Count      uint64 `json:"count"`
-	Limit      uint64 `json:"limit"`
-	PageNumber uint64 `json:"page"`
-}
+type AddressListRequest = ListRequest
 
-type addressesWrap struct {
-	Count         uint64               `json:"count"`
-	PreviousToken otils.NullableString `json:"previous"`
-	NextToken     otils.NullableString `json:"next"`
-	Addresses     []*Address           `json:"results"`
-}
-
-func pagerFromAddressListRequest(alReq *AddressListRequest) *pager {
-	pg := &pager{Limit: alReq.LimitPerPage, PageNumber: alReq.PageNumber}
-	if pg.PageNumber <= 0 {
-		// PageNumbers are 1-based for goshippo
-		pg.PageNumber = 1
+// NewAddressPager returns a Pager over the addresses of the account.
+func (c *Client) NewAddressPager(alReq *AddressListRequest) (*Pager[*Address], error) {
+	p, err := newPager[*Address](c, "ListAddresses", EndpointAddresses, "addresses", alReq)
+	if err != nil {
+		return nil, err
+	}
+	p.onResults = func(addrs []*Address) {
+		for _, addr := range addrs {
+			if addr != nil {
+				addr.normalize()
+			}
+		}
 	}
-	return pg
+	return p, nil
 }
 
-var (
-	parsedBaseURL, _ = url.Parse(baseURL)
-)
-
 func (c *Client) ListAddresses(alReq *AddressListRequest) (*AddressesPager, error) {
-	if alReq == nil {
-		alReq = new(AddressListRequest)
-	}
-
-	cancelFn, cancelChan := makeCanceler()
-	throttleDurationMs := 150 * time.Millisecond
-	if alReq.ThrottleDurationMs == NoThrottle {
-		throttleDurationMs = 0
-	} else if alReq.ThrottleDurationMs > 0 {
-		throttleDurationMs = time.Duration(alReq.ThrottleDurationMs) * time.Millisecond
-	}
-	pagesChan := make(chan *AddressPage)
+	return c.ListAddressesContext(context.Background(), alReq)
+}
 
-	maxPage := alReq.MaxPages
-	pageExceeded := func(page uint64) bool {
-		return maxPage > 0 && page >= maxPage
+// ListAddressesContext is like ListAddresses except that the paging
+// goroutine stops as soon as ctx is done, even if it is blocked
+// waiting for the consumer to receive a page from Pages. Consumers
+// that stop reading Pages early must call Cancel, or Close the client.
+func (c *Client) ListAddressesContext(ctx context.Context, alReq *AddressListRequest) (*AddressesPager, error) {
+	p, err := c.NewAddressPager(alReq)
+	if err != nil {
+		return nil, err
 	}
 
-	// pageNumbers are 1-based for goshippo
-	pageNumber := uint64(1)
-
-	var fullURL string
-	if alReq.PageToken != "" {
-		// GoShippo PageTokens are full URLs e.g
-		// https://api.goshippo.com/addresses/?limit=1&page=2
-		fullURL = alReq.PageToken
-	} else {
-		pg := pagerFromAddressListRequest(alReq)
-		qv, err := otils.ToURLValues(pg)
+	pagesChan, cancelFn, err := stream(ctx, p, func(page *Page[*Address], err error) *AddressPage {
 		if err != nil {
-			return nil, err
+			return &AddressPage{PageNumber: p.lastNumber + 1, Err: err}
 		}
-		fullURL = fmt.Sprintf("%s/addresses/", baseURL)
-		if len(qv) > 0 {
-			fullURL += "?" + qv.Encode()
+		return &AddressPage{
+			PageNumber:    page.Number,
+			Count:         page.Count,
+			Addresses:     page.Items,
+			PreviousToken: page.PreviousToken,
+			NextToken:     page.NextToken,
 		}
-	}
-
-	// Ensure that fullURL parses upfront since insertion of tokens
-	// could trip out if they aren't proper URLs.
-	parsedURL, err := url.Parse(fullURL)
+	})
 	if err != nil {
 		return nil, err
 	}
-
-	var errsList []string
-	if got, want := parsedURL.Host, parsedBaseURL.Host; got != want {
-		errsList = append(errsList, fmt.Sprintf("gotHost=%q wantHost=%q", got, want))
-	}
-	if got, want := parsedURL.Scheme, parsedBaseURL.Scheme; got != want {
-		errsList = append(errsList, fmt.Sprintf("gotScheme=%q wantSchem=%q", got, want))
-	}
-	if len(errsList) > 0 {
-		return nil, errors.New(strings.Join(errsList, "\n"))
-	}
-
-	go func() {
-		defer close(pagesChan)
-		var previousToken, nextToken otils.NullableString
-
-		for {
-			page := &AddressPage{PageNumber: pageNumber}
-			req, err := http.NewRequest("GET", fullURL, nil)
-			if err != nil {
-				page.Err = err
-				pagesChan <- page
-				return
-			}
-
-			blob, _, err := c.doAuthAndReq(req)
-			if err != nil {
-				page.Err = err
-				pagesChan <- page
-				return
-			}
-
-			pwrap := new(addressesWrap)
-			if err := json.Unmarshal(blob, pwrap); err != nil {
-				page.Err = err
-				pagesChan <- page
-				return
-			}
-			previousToken, nextToken = pwrap.PreviousToken, pwrap.NextToken
-			page.PreviousToken = string(previousToken)
-			page.NextToken = string(nextToken)
-
-			page.Addresses = pwrap.Addresses[:]
-			pagesChan <- page
-			pageNumber += 1
-
-			if pageExceeded(pageNumber) || len(pwrap.Addresses) == 0 || nextToken == "" {
-				return
-			}
-
-			select {
-			case <-time.After(throttleDurationMs):
-			case <-cancelChan:
-				return
-			}
-
-			// Now setting fullURL to be the next token because
-			// GoShippo page tokens are literally fullURLs e.g:
-			//  https://api.goshippo.com/addresses/?limit=1&page=2
-			fullURL = string(nextToken)
-		}
-	}()
-
 	return &AddressesPager{Cancel: cancelFn, Pages: pagesChan}, nil
 }
 
@@ -0,0 +1,78 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo
+
+import (
+	"context"
+)
+
+// AddressService is the part of the API that deals with
+// Addresses. Code that depends on it rather than on *Client
+// can be tested with the mocks of package goshippomock.
+type AddressService interface {
+	CreateAddress(addr *Address) (*Address, error)
+	CreateAddressContext(ctx context.Context, addr *Address) (*Address, error)
+	AddressByID(addressID string) (*Address, error)
+	AddressByIDContext(ctx context.Context, addressID string) (*Address, error)
+	ValidateAddress(addressID string) (*Address, error)
+	ValidateAddressContext(ctx context.Context, addressID string) (*Address, error)
+	ListAddresses(alReq *AddressListRequest) (*AddressesPager, error)
+	ListAddressesContext(ctx context.Context, alReq *AddressListRequest) (*AddressesPager, error)
+	NewAddressPager(alReq *AddressListRequest) (*Pager[*Address], error)
+	SyncAddresses(ctx context.Context, store Store) (*SyncResult, error)
+}
+
+// ParcelService is the part of the API that deals with Parcels.
+type ParcelService interface {
+	CreateParcel(parcel *Parcel) (*Parcel, error)
+	CreateParcelContext(ctx context.Context, parcel *Parcel) (*Parcel, error)
+	ParcelByID(parcelID string) (*Parcel, error)
+	ParcelByIDContext(ctx context.Context, parcelID string) (*Parcel, error)
+	NewParcelPager(plReq *ListRequest) (*Pager[*Parcel], error)
+	SyncParcels(ctx context.Context, store Store) (*SyncResult, error)
+}
+
+// TransactionService is the part of the API that deals with
+// Transactions, that is the purchase of labels.
+type TransactionService interface {
+	CreateTransaction(t *Transaction) (*Transaction, error)
+	CreateTransactionContext(ctx context.Context, t *Transaction) (*Transaction, error)
+	TransactionByID(transactionID string) (*Transaction, error)
+	TransactionByIDContext(ctx context.Context, transactionID string) (*Transaction, error)
+}
+
+// ManagedAccountService is the part of the API that deals with the
+// accounts managed by a Shippo Platform account.
+type ManagedAccountService interface {
+	CreateManagedAccount(acct *ManagedAccount) (*ManagedAccount, error)
+	CreateManagedAccountContext(ctx context.Context, acct *ManagedAccount) (*ManagedAccount, error)
+	ManagedAccountByID(accountID string) (*ManagedAccount, error)
+	ManagedAccountByIDContext(ctx context.Context, accountID string) (*ManagedAccount, error)
+	UpdateManagedAccount(acct *ManagedAccount) (*ManagedAccount, error)
+	UpdateManagedAccountContext(ctx context.Context, acct *ManagedAccount) (*ManagedAccount, error)
+	NewManagedAccountPager(alReq *ListRequest) (*Pager[*ManagedAccount], error)
+}
+
+// Service is the whole API, as implemented by *Client. Adding a
+// method to the API means adding it to the interfaces above and
+// regenerating package goshippomock with go generate.
+type Service interface {
+	AddressService
+	ParcelService
+	TransactionService
+	ManagedAccountService
+}
+
+var _ Service = (*Client)(nil)
@@ -0,0 +1,124 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// DefaultMaxResponseBytes is the size past which response
+// bodies are rejected, unless WithMaxResponseBytes says otherwise.
+const DefaultMaxResponseBytes = 10 << 20
+
+var ErrResponseTooLarge = errors.New("goshippo: response body exceeds the maximum size")
+
+var (
+	errIncompleteBody = errors.New("goshippo: response body ended before its JSON value did")
+	errTrailingData   = errors.New("goshippo: response body has data after its JSON value")
+)
+
+// maxPooledBuffer is the capacity past which buffers are
+// dropped instead of being pooled, so that an occasional
+// large body doesn't stay pinned in memory.
+const maxPooledBuffer = 256 << 10
+
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+func (c *Client) maxResponseBytes() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.maxBodyBytes > 0 {
+		return c.maxBodyBytes
+	}
+	return DefaultMaxResponseBytes
+}
+
+// decodeBody decodes the JSON value in body into into, straight from
+// the body, failing with ErrResponseTooLarge once more than max bytes
+// were read. Only whitespace may follow the value. A nil into discards
+// the body. If logged isn't nil, what was read is copied into it.
+func decodeBody(body io.Reader, max int64, into interface{}, logged *bytes.Buffer) error {
+	lr := &io.LimitedReader{R: body, N: max + 1}
+	var r io.Reader = lr
+	if logged != nil {
+		r = io.TeeReader(lr, logged)
+	}
+	err := decodeJSON(r, into)
+	if lr.N <= 0 {
+		return fmt.Errorf("%w: more than %d bytes", ErrResponseTooLarge, max)
+	}
+	return err
+}
+
+func decodeJSON(r io.Reader, into interface{}) error {
+	if into == nil {
+		_, err := io.Copy(io.Discard, r)
+		return err
+	}
+	dec := json.NewDecoder(r)
+	switch err := dec.Decode(into); err {
+	case nil:
+	case io.EOF, io.ErrUnexpectedEOF:
+		return errIncompleteBody
+	default:
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errTrailingData
+	}
+	return nil
+}
+
+// readBody reads body, that of an error response, into buf, failing
+// with ErrResponseTooLarge as soon as it turns out to be longer than
+// max bytes. It reads into buf directly so that a pooled buf is all
+// that is needed.
+func readBody(buf *bytes.Buffer, body io.Reader, max int64) error {
+	for {
+		if int64(buf.Len()) > max {
+			return ErrResponseTooLarge
+		}
+		buf.Grow(bytes.MinRead)
+		p := buf.AvailableBuffer()
+		n, err := body.Read(p[:cap(p)])
+		buf.Write(p[:n])
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/orijtech/goshippo/v1"
+)
+
+func TestMaxResponseBytes(t *testing.T) {
+	parcel, err := os.ReadFile("./testdata/parcel-1.json")
+	if err != nil {
+		t.Fatalf("readFile err: %v", err)
+	}
+	size := int64(len(parcel))
+
+	tests := [...]struct {
+		max      int64
+		body     string
+		logLevel goshippo.LogLevel
+		wantErr  error
+		anyErr   bool
+	}{
+		0: {max: 0, body: string(parcel)},
+		1: {max: size, body: string(parcel)},
+		2: {max: size - 1, body: string(parcel), wantErr: goshippo.ErrResponseTooLarge},
+		3: {max: size - 1, body: string(parcel), logLevel: goshippo.LogBodies, wantErr: goshippo.ErrResponseTooLarge},
+		4: {max: size + 10, body: string(parcel) + "  \n"},
+		5: {body: string(parcel) + `{"object_id": "again"}`, anyErr: true},
+		6: {body: `{"object_id": `, anyErr: true},
+		7: {body: "", anyErr: true},
+	}
+
+	for i, tt := range tests {
+		var attempts int32
+		opts := []goshippo.Option{
+			goshippo.WithAPIKey(token1),
+			goshippo.WithMaxResponseBytes(tt.max),
+			goshippo.WithRetryPolicy(&goshippo.RetryPolicy{MaxAttempts: 3, RetryNetworkErrors: true}),
+			goshippo.WithHTTPRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				atomic.AddInt32(&attempts, 1)
+				res := makeResp("200 OK", http.StatusOK)
+				res.Body = ioutil.NopCloser(strings.NewReader(tt.body))
+				return res, nil
+			})),
+		}
+		client, err := goshippo.New(opts...)
+		if err != nil {
+			t.Fatalf("#%d: client err: %v", i, err)
+		}
+		client.SetLogger(discardLogger{})
+		client.SetLogLevel(tt.logLevel)
+
+		got, err := client.ParcelByID("adcfdddf8ec64b84ad22772bce3ea37a")
+		// Bodies that can't be decoded are never retried.
+		if n := atomic.LoadInt32(&attempts); n != 1 {
+			t.Errorf("#%d: gotAttempts=%d wantAttempts=1", i, n)
+		}
+		if tt.wantErr != nil || tt.anyErr {
+			if err == nil {
+				t.Errorf("#%d: expected a non-nil error", i)
+			} else if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("#%d: gotErr=%v wantErr=%v", i, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: gotErr=%v", i, err)
+			continue
+		}
+		if got.ID == "" {
+			t.Errorf("#%d: expected a non-blank parcel", i)
+		}
+	}
+}
+
+func TestNegativeMaxResponseBytes(t *testing.T) {
+	if _, err := goshippo.New(goshippo.WithAPIKey(token1), goshippo.WithMaxResponseBytes(-1)); err == nil {
+		t.Error("expected a non-nil error")
+	}
+}
+
+func TestClientReusesHTTPClient(t *testing.T) {
+	var requests int32
+	client, err := goshippo.NewClient(token1)
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	client.SetHTTPRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&requests, 1)
+		return respFromFile("./testdata/parcel-1.json")
+	}))
+	if _, err := client.ParcelByID("adcfdddf8ec64b84ad22772bce3ea37a"); err != nil {
+		t.Fatalf("parcelByID err: %v", err)
+	}
+
+	// Changing the transport must take effect
+	// despite the http.Client being reused.
+	client.SetHTTPRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return makeResp("404 Not Found", http.StatusNotFound), nil
+	}))
+	if _, err := client.ParcelByID("adcfdddf8ec64b84ad22772bce3ea37a"); err == nil {
+		t.Error("expected the new transport to be used")
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("gotRequests=%d wantRequests=1", n)
+	}
+}
+
+type discardLogger struct{}
+
+func (discardLogger) Printf(format string, args ...interface{}) {}
+
+// staticBodyTransport answers every request with body.
+func staticBodyTransport(body []byte) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		res := makeResp("200 OK", http.StatusOK)
+		res.Body = ioutil.NopCloser(bytes.NewReader(body))
+		return res, nil
+	})
+}
+
+func benchmarkClient(b *testing.B, path string) *goshippo.Client {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		b.Fatalf("readFile err: %v", err)
+	}
+	client, err := goshippo.New(goshippo.WithAPIKey(token1), goshippo.WithHTTPRoundTripper(staticBodyTransport(body)))
+	if err != nil {
+		b.Fatalf("client err: %v", err)
+	}
+	return client
+}
+
+// BenchmarkDecodeParcel compares decoding a response straight from the
+// body with the ReadAll and Unmarshal that the client used to do.
+func BenchmarkDecodeParcel(b *testing.B) {
+	body, err := os.ReadFile("./testdata/parcel-1.json")
+	if err != nil {
+		b.Fatalf("readFile err: %v", err)
+	}
+
+	b.Run("ReadAll+Unmarshal", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(body)))
+		for i := 0; i < b.N; i++ {
+			blob, err := ioutil.ReadAll(bytes.NewReader(body))
+			if err != nil {
+				b.Fatalf("readAll err: %v", err)
+			}
+			if err := json.Unmarshal(blob, new(goshippo.Parcel)); err != nil {
+				b.Fatalf("unmarshal err: %v", err)
+			}
+		}
+	})
+
+	b.Run("Decode", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(body)))
+		for i := 0; i < b.N; i++ {
+			err := goshippo.DecodeBody(bytes.NewReader(body), goshippo.DefaultMaxResponseBytes, new(goshippo.Parcel), nil)
+			if err != nil {
+				b.Fatalf("decode err: %v", err)
+			}
+		}
+	})
+}
+
+func BenchmarkParcelByID(b *testing.B) {
+	client := benchmarkClient(b, "./testdata/parcel-1.json")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := client.ParcelByID("adcfdddf8ec64b84ad22772bce3ea37a"); err != nil {
+			b.Fatalf("parcelByID err: %v", err)
+		}
+	}
+}
+
+func BenchmarkCreateParcel(b *testing.B) {
+	client := benchmarkClient(b, "./testdata/parcel-1.json")
+	parcel := &goshippo.Parcel{
+		Length: 10.3, Width: 12.0, Height: 25, Weight: 99.2,
+		DistanceUnit: goshippo.DistanceYard, MassUnit: goshippo.MassKilogram,
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := client.CreateParcel(parcel); err != nil {
+			b.Fatalf("createParcel err: %v", err)
+		}
+	}
+}
+
+func BenchmarkAddressPage(b *testing.B) {
+	client := benchmarkClient(b, "./testdata/address-list-1.json")
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pager, err := client.NewAddressPager(&goshippo.AddressListRequest{MaxPages: 1, ThrottleDurationMs: goshippo.NoThrottle})
+		if err != nil {
+			b.Fatalf("newPager err: %v", err)
+		}
+		if !pager.Next(ctx) {
+			b.Fatalf("next err: %v", pager.Err())
+		}
+	}
+}
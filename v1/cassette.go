@@ -0,0 +1,346 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+type CassetteMode int
+
+const (
+	// CassetteReplay serves responses from the cassette and fails
+	// requests that it has no recorded interaction for. It is the
+	// default so that tests never reach the network by accident.
+	CassetteReplay CassetteMode = iota
+
+	// CassetteRecord sends requests to the backend and records
+	// the scrubbed interactions, saving the cassette after each.
+	CassetteRecord
+
+	// CassettePassthrough sends requests to the
+	// backend without recording or replaying them.
+	CassettePassthrough
+)
+
+func (cm CassetteMode) String() string {
+	switch cm {
+	case CassetteReplay:
+		return "replay"
+	case CassetteRecord:
+		return "record"
+	case CassettePassthrough:
+		return "passthrough"
+	default:
+		return fmt.Sprintf("CassetteMode(%d)", int(cm))
+	}
+}
+
+// Cassette is an http.RoundTripper, for SetHTTPRoundTripper, that
+// records interactions with the backend to a file and replays them.
+// Requests are matched by method, path, query and body, where JSON
+// bodies match regardless of the order of their keys. Credentials,
+// tokens and PII are scrubbed before anything is written, so
+// replayed responses carry redacted values in their place.
+type Cassette struct {
+	mu sync.Mutex
+
+	path string
+	mode CassetteMode
+	base http.RoundTripper
+
+	interactions []*Interaction
+	replayed     []bool
+}
+
+var _ http.RoundTripper = (*Cassette)(nil)
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Request  *RecordedRequest  `json:"request"`
+	Response *RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Status     string      `json:"status"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+var ErrCassetteMiss = errors.New("goshippo: no recorded interaction matches the request")
+
+var (
+	// secretKeys are the JSON keys whose
+	// values are scrubbed from cassettes.
+	secretKeys = map[string]bool{
+		"access_token":  true,
+		"refresh_token": true,
+		"client_secret": true,
+		"api_key":       true,
+		"password":      true,
+	}
+
+	cassetteKeys = func() map[string]bool {
+		keys := make(map[string]bool)
+		for key := range piiKeys {
+			keys[key] = true
+		}
+		for key := range secretKeys {
+			keys[key] = true
+		}
+		return keys
+	}()
+)
+
+// NewCassette returns a Cassette for the file at path in mode. base
+// is the transport that CassetteRecord and CassettePassthrough send
+// requests with, http.DefaultTransport if nil. For CassetteReplay the
+// file must exist, while CassetteRecord overwrites it.
+func NewCassette(path string, mode CassetteMode, base http.RoundTripper) (*Cassette, error) {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	cs := &Cassette{path: path, mode: mode, base: base}
+	if mode != CassetteReplay {
+		return cs, nil
+	}
+
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(blob, &cs.interactions); err != nil {
+		return nil, fmt.Errorf("cassette %q: %v", path, err)
+	}
+	cs.replayed = make([]bool, len(cs.interactions))
+	return cs, nil
+}
+
+func (cs *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch cs.mode {
+	case CassettePassthrough:
+		return cs.base.RoundTrip(req)
+	case CassetteRecord:
+		return cs.record(req)
+	default:
+		return cs.replay(req)
+	}
+}
+
+// readRequestBody reads, and closes as RoundTrip must, the body of req.
+// It returns the body with a clone of req that can still be sent, since
+// RoundTrip mustn't modify req itself.
+func readRequestBody(req *http.Request) (*http.Request, []byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	clone := req.Clone(req.Context())
+	clone.Body = ioutil.NopCloser(bytes.NewReader(body))
+	clone.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	return clone, body, nil
+}
+
+// scrubBody masks the secrets and PII of JSON bodies. Other
+// bodies are kept as they are, except for form encoded ones
+// whose secrets, such as OAuth client secrets, are masked.
+func scrubBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err == nil {
+		blob, err := json.Marshal(maskKeys(v, cassetteKeys))
+		if err == nil {
+			return string(blob)
+		}
+	}
+	if qv, err := url.ParseQuery(string(body)); err == nil && strings.Contains(string(body), "=") {
+		for key := range qv {
+			if secretKeys[key] || key == "code" {
+				qv.Set(key, redacted)
+			}
+		}
+		return qv.Encode()
+	}
+	return string(body)
+}
+
+func scrubURL(u *url.URL) string {
+	scrubbed := *u
+	scrubbed.User = nil
+	qv := scrubbed.Query()
+	for key := range qv {
+		if secretKeys[key] {
+			qv.Set(key, redacted)
+		}
+	}
+	scrubbed.RawQuery = qv.Encode()
+	return scrubbed.String()
+}
+
+func (cs *Cassette) record(req *http.Request) (*http.Response, error) {
+	sent, reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	res, err := cs.base.RoundTrip(sent)
+	if err != nil {
+		return nil, err
+	}
+	var resBody []byte
+	if res.Body != nil {
+		resBody, err = ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(resBody))
+
+	interaction := &Interaction{
+		Request: &RecordedRequest{
+			Method: req.Method,
+			URL:    scrubURL(req.URL),
+			Header: redactHeaders(req.Header),
+			Body:   scrubBody(reqBody),
+		},
+		Response: &RecordedResponse{
+			StatusCode: res.StatusCode,
+			Status:     res.Status,
+			Header:     redactHeaders(res.Header),
+			Body:       scrubBody(resBody),
+		},
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.interactions = append(cs.interactions, interaction)
+	blob, err := json.MarshalIndent(cs.interactions, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomically(cs.path, blob); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// matchKey is what requests are matched by. Query parameters are
+// sorted and bodies are scrubbed, then re-encoded for JSON bodies
+// so that the order of their keys doesn't matter.
+func matchKey(method, rawURL, body string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	qv := u.Query()
+	for key := range qv {
+		if secretKeys[key] {
+			qv.Set(key, redacted)
+		}
+	}
+	return fmt.Sprintf("%s %s?%s\n%s", strings.ToUpper(method), u.Path, qv.Encode(), body), nil
+}
+
+func (cs *Cassette) replay(req *http.Request) (*http.Response, error) {
+	_, reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	want, err := matchKey(req.Method, req.URL.String(), scrubBody(reqBody))
+	if err != nil {
+		return nil, err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	// Identical requests are replayed in the order that they were
+	// recorded in, repeating the last one once all were replayed.
+	match := -1
+	for i, interaction := range cs.interactions {
+		rreq := interaction.Request
+		got, err := matchKey(rreq.Method, rreq.URL, scrubBody([]byte(rreq.Body)))
+		if err != nil || got != want {
+			continue
+		}
+		match = i
+		if !cs.replayed[i] {
+			break
+		}
+	}
+	if match < 0 {
+		return nil, fmt.Errorf("%w: %s %s in cassette %q (%d interactions)", ErrCassetteMiss, req.Method, scrubURL(req.URL), cs.path, len(cs.interactions))
+	}
+	cs.replayed[match] = true
+
+	rres := cs.interactions[match].Response
+	header := rres.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        rres.Status,
+		StatusCode:    rres.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(rres.Body)),
+		ContentLength: int64(len(rres.Body)),
+		Request:       req,
+	}, nil
+}
+
+// Unreplayed returns the recorded interactions that were not replayed,
+// so that tests can check that the code under test made every call.
+func (cs *Cassette) Unreplayed() []*Interaction {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	var unreplayed []*Interaction
+	for i, interaction := range cs.interactions {
+		if cs.mode == CassetteReplay && !cs.replayed[i] {
+			unreplayed = append(unreplayed, interaction)
+		}
+	}
+	return unreplayed
+}
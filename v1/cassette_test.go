@@ -0,0 +1,237 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/orijtech/goshippo/v1"
+)
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "addresses.json")
+
+	var sent int
+	live := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		sent += 1
+		res := makeResp("201 Created", http.StatusCreated)
+		res.Header = http.Header{"Set-Cookie": {"session=abcdef"}}
+		res.Body = ioutil.NopCloser(strings.NewReader(`{"object_id": "addr-1", "name": "Emmanuel Odeke", "email": "emm@example.com", "country": "US"}`))
+		return res, nil
+	})
+	addr := &goshippo.Address{Purpose: "PURCHASE", AddresseeName: "Emmanuel Odeke", Email: "emm@example.com", Country: "US"}
+
+	recorder, err := goshippo.NewCassette(path, goshippo.CassetteRecord, live)
+	if err != nil {
+		t.Fatalf("recorder err: %v", err)
+	}
+	client, err := goshippo.NewClient("shippo_test_secrettoken")
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	client.SetHTTPRoundTripper(recorder)
+	if _, err := client.CreateAddress(addr); err != nil {
+		t.Fatalf("recording createAddress err: %v", err)
+	}
+
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading cassette: %v", err)
+	}
+	for _, secret := range []string{"secrettoken", "Emmanuel", "emm@example.com", "session=abcdef"} {
+		if strings.Contains(string(blob), secret) {
+			t.Errorf("cassette leaks %q:\n%s", secret, blob)
+		}
+	}
+
+	player, err := goshippo.NewCassette(path, goshippo.CassetteReplay, nil)
+	if err != nil {
+		t.Fatalf("player err: %v", err)
+	}
+	client.SetHTTPRoundTripper(player)
+	got, err := client.CreateAddress(addr)
+	if err != nil {
+		t.Fatalf("replaying createAddress err: %v", err)
+	}
+	if got.ID != "addr-1" || sent != 1 {
+		t.Errorf("gotID=%q gotSent=%d want addr-1 and 1", got.ID, sent)
+	}
+	if unreplayed := player.Unreplayed(); len(unreplayed) != 0 {
+		t.Errorf("gotUnreplayed=%d wantUnreplayed=0", len(unreplayed))
+	}
+
+	// A request that was never recorded must fail, not reach the network.
+	other := *addr
+	other.Country = "CA"
+	if _, err := client.CreateAddress(&other); !errors.Is(err, goshippo.ErrCassetteMiss) {
+		t.Errorf("gotErr=%v wantErr=%v", err, goshippo.ErrCassetteMiss)
+	}
+	// Misses are reported at once, never retried.
+	meta := new(goshippo.ResponseMeta)
+	if _, err := client.AddressByIDContext(goshippo.WithResponseMeta(context.Background(), meta), "addr-1"); !errors.Is(err, goshippo.ErrCassetteMiss) {
+		t.Errorf("gotErr=%v wantErr=%v", err, goshippo.ErrCassetteMiss)
+	}
+	if got, want := meta.Snapshot().Attempts, 1; got != want {
+		t.Errorf("gotAttempts=%d wantAttempts=%d", got, want)
+	}
+}
+
+func TestCassetteScrubsManagedAccounts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.json")
+	recorder, err := goshippo.NewCassette(path, goshippo.CassetteRecord, roundTripperFunc(managedAccountRoundTrip))
+	if err != nil {
+		t.Fatalf("recorder err: %v", err)
+	}
+	client, err := goshippo.NewClient(token1)
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	client.SetHTTPRoundTripper(recorder)
+	acct := &goshippo.ManagedAccount{Email: "ada@example.org", FirstName: "Augusta", LastName: "Lovelace", CompanyName: "Analytical Engines"}
+	if _, err := client.CreateManagedAccount(acct); err != nil {
+		t.Fatalf("recording createManagedAccount err: %v", err)
+	}
+
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading cassette: %v", err)
+	}
+	for _, secret := range []string{"Augusta", "Lovelace", "Analytical Engines", "ada@example.org"} {
+		if strings.Contains(string(blob), secret) {
+			t.Errorf("cassette leaks %q:\n%s", secret, blob)
+		}
+	}
+}
+
+func TestCassetteRecordsNilBodies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deleted.json")
+	live := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return makeResp("204 No Content", http.StatusNoContent), nil
+	})
+	recorder, err := goshippo.NewCassette(path, goshippo.CassetteRecord, live)
+	if err != nil {
+		t.Fatalf("recorder err: %v", err)
+	}
+	req, err := http.NewRequest("DELETE", "https://api.goshippo.com/webhooks/wh-1/", nil)
+	if err != nil {
+		t.Fatalf("request err: %v", err)
+	}
+	res, err := recorder.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("recording err: %v", err)
+	}
+	if body, _ := ioutil.ReadAll(res.Body); res.StatusCode != http.StatusNoContent || len(body) != 0 {
+		t.Errorf("gotStatusCode=%d gotBody=%q want an empty 204", res.StatusCode, body)
+	}
+}
+
+func TestCassetteLeavesRequestsAlone(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "parcels.json")
+	const sentBody = `{"length": "5"}`
+	var gotBody string
+	live := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		blob, _ := ioutil.ReadAll(req.Body)
+		gotBody = string(blob)
+		return respFromFile("./testdata/parcel-1.json")
+	})
+
+	for i, mode := range []goshippo.CassetteMode{goshippo.CassetteRecord, goshippo.CassetteReplay} {
+		cassette, err := goshippo.NewCassette(path, mode, live)
+		if err != nil {
+			t.Fatalf("#%d: cassette err: %v", i, err)
+		}
+		body := ioutil.NopCloser(strings.NewReader(sentBody))
+		req, err := http.NewRequest("POST", "https://api.goshippo.com/parcels/", body)
+		if err != nil {
+			t.Fatalf("#%d: request err: %v", i, err)
+		}
+		req.GetBody = nil
+		if _, err := cassette.RoundTrip(req); err != nil {
+			t.Fatalf("#%d: roundTrip err: %v", i, err)
+		}
+		if req.Body != body || req.GetBody != nil {
+			t.Errorf("#%d: the body of the request was replaced", i)
+		}
+	}
+	if gotBody != sentBody {
+		t.Errorf("gotBody=%q wantBody=%q", gotBody, sentBody)
+	}
+}
+
+func TestCassetteMatching(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	cassette := `[
+  {"request": {"method": "GET", "url": "https://api.goshippo.com/addresses/?page=2&limit=5"},
+   "response": {"status_code": 200, "status": "200 OK", "body": "{\"count\": 6, \"results\": []}"}},
+  {"request": {"method": "POST", "url": "https://api.goshippo.com/parcels/", "body": "{\"weight\": \"2\", \"length\": \"5\"}"},
+   "response": {"status_code": 201, "status": "201 Created", "body": "{\"object_id\": \"p-1\"}"}},
+  {"request": {"method": "POST", "url": "https://api.goshippo.com/parcels/", "body": "{\"weight\": \"2\", \"length\": \"5\"}"},
+   "response": {"status_code": 201, "status": "201 Created", "body": "{\"object_id\": \"p-2\"}"}}
+]`
+	if err := os.WriteFile(path, []byte(cassette), 0600); err != nil {
+		t.Fatalf("writing cassette: %v", err)
+	}
+	player, err := goshippo.NewCassette(path, goshippo.CassetteReplay, nil)
+	if err != nil {
+		t.Fatalf("player err: %v", err)
+	}
+
+	tests := [...]struct {
+		method, url, body string
+		wantBody          string
+		wantMiss          bool
+	}{
+		// Query parameters match in any order, on any host.
+		0: {method: "GET", url: "http://localhost:8080/addresses/?limit=5&page=2", wantBody: `{"count": 6, "results": []}`},
+		1: {method: "GET", url: "https://api.goshippo.com/addresses/?limit=5&page=3", wantMiss: true},
+		// JSON keys match in any order and identical
+		// requests are replayed in the recorded order.
+		2: {method: "POST", url: "https://api.goshippo.com/parcels/", body: `{"length":"5","weight":"2"}`, wantBody: `{"object_id": "p-1"}`},
+		3: {method: "POST", url: "https://api.goshippo.com/parcels/", body: `{"weight": "2", "length": "5"}`, wantBody: `{"object_id": "p-2"}`},
+		4: {method: "POST", url: "https://api.goshippo.com/parcels/", body: `{"weight": "2", "length": "5"}`, wantBody: `{"object_id": "p-2"}`},
+		5: {method: "POST", url: "https://api.goshippo.com/parcels/", body: `{"weight": "3", "length": "5"}`, wantMiss: true},
+		6: {method: "PUT", url: "https://api.goshippo.com/parcels/", body: `{"weight": "2", "length": "5"}`, wantMiss: true},
+	}
+
+	for i, tt := range tests {
+		req, err := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("#%d: request err: %v", i, err)
+		}
+		res, err := player.RoundTrip(req)
+		if tt.wantMiss {
+			if !errors.Is(err, goshippo.ErrCassetteMiss) {
+				t.Errorf("#%d: gotErr=%v wantErr=%v", i, err, goshippo.ErrCassetteMiss)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: gotErr=%v", i, err)
+			continue
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if string(body) != tt.wantBody {
+			t.Errorf("#%d: gotBody=%s wantBody=%s", i, body, tt.wantBody)
+		}
+	}
+}
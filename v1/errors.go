@@ -0,0 +1,200 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// APIError is returned whenever the GoShippo backend responds
+// with a non-2XX status code. Use errors.As to retrieve it.
+type APIError struct {
+	// StatusCode is the HTTP status code of the response e.g 400.
+	StatusCode int `json:"status_code"`
+
+	// Status is the HTTP status line e.g "400 Bad Request".
+	Status string `json:"status"`
+
+	// Detail is the top level message that GoShippo
+	// sends for errors such as authentication failures
+	// and unknown objects e.g {"detail": "Not found."}
+	Detail string `json:"detail,omitempty"`
+
+	// Fields maps the name of each offending field to the
+	// validation messages that GoShippo returned for it.
+	// Nested fields are joined with a "." e.g "address_from.zip".
+	Fields map[string][]string `json:"fields,omitempty"`
+
+	// Body is the raw response body.
+	Body []byte `json:"-"`
+
+	// Header contains the response headers.
+	Header http.Header `json:"-"`
+}
+
+var _ error = (*APIError)(nil)
+
+func (ae *APIError) Error() string {
+	if ae == nil {
+		return "<nil>"
+	}
+	var parts []string
+	if ae.Detail != "" {
+		parts = append(parts, ae.Detail)
+	}
+	keys := make([]string, 0, len(ae.Fields))
+	for key := range ae.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s: %s", key, strings.Join(ae.Fields[key], " ")))
+	}
+
+	status := ae.Status
+	if status == "" {
+		status = fmt.Sprintf("%d %s", ae.StatusCode, http.StatusText(ae.StatusCode))
+	}
+	if len(parts) == 0 {
+		return status
+	}
+	return fmt.Sprintf("%s: %s", status, strings.Join(parts, "; "))
+}
+
+// RequestID returns the identifier that the backend
+// assigned to the failed request, if it sent one.
+func (ae *APIError) RequestID() string {
+	if ae == nil || ae.Header == nil {
+		return ""
+	}
+	return firstHeader(ae.Header, "X-Request-Id", "X-Shippo-Request-Id")
+}
+
+// IsAuth reports whether the request failed
+// because of missing or invalid credentials.
+func (ae *APIError) IsAuth() bool {
+	return ae != nil && (ae.StatusCode == http.StatusUnauthorized || ae.StatusCode == http.StatusForbidden)
+}
+
+// IsValidation reports whether the backend rejected the request body.
+func (ae *APIError) IsValidation() bool {
+	return ae != nil && (ae.StatusCode == http.StatusBadRequest || ae.StatusCode == http.StatusUnprocessableEntity)
+}
+
+// IsNotFound reports whether the requested object does not exist.
+func (ae *APIError) IsNotFound() bool {
+	return ae != nil && ae.StatusCode == http.StatusNotFound
+}
+
+// IsRateLimited reports whether the request was rejected
+// because the account exceeded its rate limit.
+func (ae *APIError) IsRateLimited() bool {
+	return ae != nil && ae.StatusCode == http.StatusTooManyRequests
+}
+
+// IsServer reports whether the backend failed with a 5XX status code.
+func (ae *APIError) IsServer() bool {
+	return ae != nil && ae.StatusCode >= 500
+}
+
+func firstHeader(hdr http.Header, keys ...string) string {
+	for _, key := range keys {
+		if value := strings.TrimSpace(hdr.Get(key)); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func makeAPIError(res *http.Response, body []byte) *APIError {
+	ae := &APIError{
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+		Body:       body,
+		Header:     res.Header,
+	}
+
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(body, &fields); err != nil {
+		// Not a JSON object, so the best we can do is to
+		// surface the text e.g an HTML error page from a proxy.
+		if text := strings.TrimSpace(string(body)); text != "" && len(text) <= 256 {
+			ae.Detail = text
+		}
+		return ae
+	}
+
+	if raw, ok := fields["detail"]; ok {
+		var detail string
+		if err := json.Unmarshal(raw, &detail); err == nil {
+			ae.Detail = detail
+			delete(fields, "detail")
+		}
+	}
+
+	for key, raw := range fields {
+		flattenErrorMessages(ae, key, raw)
+	}
+	return ae
+}
+
+// flattenErrorMessages records the messages in raw under key. GoShippo
+// sends them either as a string, a list of strings or as an object
+// keyed by the nested field names.
+func flattenErrorMessages(ae *APIError, key string, raw json.RawMessage) {
+	var msg string
+	if err := json.Unmarshal(raw, &msg); err == nil {
+		ae.addFieldMessages(key, msg)
+		return
+	}
+
+	var msgs []string
+	if err := json.Unmarshal(raw, &msgs); err == nil {
+		ae.addFieldMessages(key, msgs...)
+		return
+	}
+
+	var nested map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &nested); err == nil {
+		for subKey, subRaw := range nested {
+			flattenErrorMessages(ae, key+"."+subKey, subRaw)
+		}
+		return
+	}
+
+	var nestedList []json.RawMessage
+	if err := json.Unmarshal(raw, &nestedList); err == nil {
+		for _, subRaw := range nestedList {
+			flattenErrorMessages(ae, key, subRaw)
+		}
+		return
+	}
+
+	ae.addFieldMessages(key, string(raw))
+}
+
+func (ae *APIError) addFieldMessages(key string, msgs ...string) {
+	if len(msgs) == 0 {
+		return
+	}
+	if ae.Fields == nil {
+		ae.Fields = make(map[string][]string)
+	}
+	ae.Fields[key] = append(ae.Fields[key], msgs...)
+}
@@ -0,0 +1,127 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/orijtech/goshippo/v1"
+)
+
+func TestAPIError(t *testing.T) {
+	tests := [...]struct {
+		code       int
+		body       string
+		header     http.Header
+		wantDetail string
+		wantFields map[string][]string
+		wantReqID  string
+		check      func(*goshippo.APIError) bool
+	}{
+		0: {
+			code:       http.StatusUnauthorized,
+			body:       `{"detail": "Invalid token."}`,
+			wantDetail: "Invalid token.",
+			check:      (*goshippo.APIError).IsAuth,
+		},
+		1: {
+			code: http.StatusBadRequest,
+			body: `{"street1": ["This field is required."], "address_from": {"zip": ["Invalid zip."]}}`,
+			wantFields: map[string][]string{
+				"street1":          {"This field is required."},
+				"address_from.zip": {"Invalid zip."},
+			},
+			check: (*goshippo.APIError).IsValidation,
+		},
+		2: {
+			code:       http.StatusNotFound,
+			body:       `{"detail": "Not found."}`,
+			header:     http.Header{"X-Request-Id": {"req-123"}},
+			wantDetail: "Not found.",
+			wantReqID:  "req-123",
+			check:      (*goshippo.APIError).IsNotFound,
+		},
+		3: {
+			code:  http.StatusTooManyRequests,
+			body:  ``,
+			check: (*goshippo.APIError).IsRateLimited,
+		},
+		4: {
+			code:       http.StatusBadGateway,
+			body:       `<html>Bad gateway</html>`,
+			wantDetail: "<html>Bad gateway</html>",
+			check:      (*goshippo.APIError).IsServer,
+		},
+	}
+
+	for i, tt := range tests {
+		client, err := goshippo.NewClient(token1)
+		if err != nil {
+			t.Fatalf("#%d: client err: %v", i, err)
+		}
+		// Check the error of the first response, without retries.
+		client.SetRetryPolicy(&goshippo.RetryPolicy{MaxAttempts: 1})
+		client.SetHTTPRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			header := tt.header
+			if header == nil {
+				header = make(http.Header)
+			}
+			return &http.Response{
+				StatusCode: tt.code,
+				Status:     http.StatusText(tt.code),
+				Header:     header,
+				Body:       ioutil.NopCloser(strings.NewReader(tt.body)),
+			}, nil
+		}))
+
+		_, err = client.AddressByID(addrID1)
+		ae := new(goshippo.APIError)
+		if !errors.As(err, &ae) {
+			t.Errorf("#%d: got err=%#v want *APIError", i, err)
+			continue
+		}
+		if got, want := ae.StatusCode, tt.code; got != want {
+			t.Errorf("#%d: gotStatusCode=%d wantStatusCode=%d", i, got, want)
+		}
+		if got, want := ae.Detail, tt.wantDetail; got != want {
+			t.Errorf("#%d: gotDetail=%q wantDetail=%q", i, got, want)
+		}
+		if got, want := ae.Fields, tt.wantFields; !reflect.DeepEqual(got, want) {
+			t.Errorf("#%d: gotFields=%v wantFields=%v", i, got, want)
+		}
+		if got, want := ae.RequestID(), tt.wantReqID; got != want {
+			t.Errorf("#%d: gotRequestID=%q wantRequestID=%q", i, got, want)
+		}
+		if got, want := string(ae.Body), tt.body; got != want {
+			t.Errorf("#%d: gotBody=%q wantBody=%q", i, got, want)
+		}
+		if !tt.check(ae) {
+			t.Errorf("#%d: error class check failed for %v", i, ae)
+		}
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+var _ http.RoundTripper = (roundTripperFunc)(nil)
+
+func (fn roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
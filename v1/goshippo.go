@@ -15,19 +15,23 @@
 package goshippo
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/orijtech/otils"
+	"go.opencensus.io/plugin/ochttp"
 )
 
 const (
-	baseURL = "https://api.goshippo.com"
+	defaultBaseURL = "https://api.goshippo.com"
 
 	envGoShippoToken = "GOSHIPPO_TOKEN"
 )
@@ -35,9 +39,44 @@ const (
 type Client struct {
 	mu sync.RWMutex
 
-	rt http.RoundTripper
+	rt      http.RoundTripper
+	timeout time.Duration
+
+	// hc is built from rt and timeout on first use,
+	// then reused so that connections are pooled.
+	hc           *http.Client
+	maxBodyBytes int64
+
+	userAgentSuffix string
+	apiVersion      APIVersion
+	logger          Logger
+	logLevel        LogLevel
+	logPII          bool
+
+	retryPolicy *RetryPolicy
+	rateLimiter *RateLimiter
+	journal     Journal
+
+	middleware []Middleware
 
-	__apiKey string
+	livePurchaseGuard bool
+	objectModes       objectModes
+
+	// lifetime is cancelled by Close to stop
+	// all the pagers, which pagers tracks.
+	lifetime       context.Context
+	cancelLifetime context.CancelFunc
+	closed         bool
+	pagers         sync.WaitGroup
+
+	__baseURL *url.URL
+
+	// tokenSource, if set, supplies the API key in place of
+	// __apiKey. authScheme is that of the Authorization header,
+	// ShippoToken unless an OAuth access token is used.
+	tokenSource TokenSource
+	authScheme  string
+	__apiKey    string
 }
 
 func NewClient(tokens ...string) (*Client, error) {
@@ -60,50 +99,281 @@ func NewClientFromEnv() (*Client, error) {
 	return &Client{__apiKey: token}, nil
 }
 
+var ErrClientClosed = errors.New("goshippo: client is closed")
+
+// Close stops all the outstanding pagers of the client, closing
+// their Pages channels, and waits for them to exit. Any paging
+// started after Close fails with ErrClientClosed.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	if c.cancelLifetime != nil {
+		c.cancelLifetime()
+	}
+	c.mu.Unlock()
+
+	c.pagers.Wait()
+	return nil
+}
+
+// startPager binds ctx to the lifetime of the client. The returned
+// release func must be called once the pager stops using ctx.
+func (c *Client) startPager(ctx context.Context) (context.Context, func(), error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, nil, ErrClientClosed
+	}
+	if c.lifetime == nil {
+		c.lifetime, c.cancelLifetime = context.WithCancel(context.Background())
+	}
+	lifetime := c.lifetime
+	c.pagers.Add(1)
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(lifetime, cancel)
+	release := func() {
+		stop()
+		cancel()
+		c.pagers.Done()
+	}
+	return ctx, release, nil
+}
+
+// SetAPIKey makes the client authenticate with key,
+// replacing any TokenSource that it was using.
 func (c *Client) SetAPIKey(key string) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	c.__apiKey = key
+	c.tokenSource = nil
+	c.authScheme = schemeShippoToken
 }
 
 func (c *Client) SetHTTPRoundTripper(rt http.RoundTripper) {
 	c.mu.Lock()
 	c.rt = rt
+	c.hc = nil
 	c.mu.Unlock()
 }
 
+var (
+	errBaseURLNoHost    = errors.New("expecting the base URL to have a host")
+	errBaseURLBadScheme = errors.New("expecting the base URL to have an http or https scheme")
+
+	parsedDefaultBaseURL, _ = url.Parse(defaultBaseURL)
+)
+
+// SetBaseURL makes the client send all its requests to rawURL
+// instead of https://api.goshippo.com e.g to target a local fake
+// server, an egress proxy or a regional endpoint. rawURL can
+// contain a path prefix, which will be preserved. Setting a
+// blank rawURL restores the default.
+func (c *Client) SetBaseURL(rawURL string) error {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		c.mu.Lock()
+		c.__baseURL = nil
+		c.mu.Unlock()
+		return nil
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return errBaseURLBadScheme
+	}
+	if parsed.Host == "" {
+		return errBaseURLNoHost
+	}
+	parsed.Path = strings.TrimRight(parsed.Path, "/")
+	parsed.RawPath = ""
+	parsed.RawQuery = ""
+	parsed.Fragment = ""
+
+	c.mu.Lock()
+	c.__baseURL = parsed
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Client) parsedBaseURL() *url.URL {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.__baseURL != nil {
+		return c.__baseURL
+	}
+	return parsedDefaultBaseURL
+}
+
+func (c *Client) baseURL() string {
+	return c.parsedBaseURL().String()
+}
+
 func (c *Client) httpClient() *http.Client {
 	c.mu.RLock()
-	rt := c.rt
+	hc := c.hc
 	c.mu.RUnlock()
+	if hc != nil {
+		return hc
+	}
 
-	if rt == nil {
-		rt = http.DefaultTransport
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.hc == nil {
+		rt := c.rt
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+		// ochttp.Transport propagates the span in
+		// the request's context to the RoundTripper.
+		transport := &ochttp.Transport{Base: nilBodyTransport{rt}}
+		c.hc = &http.Client{Transport: transport, Timeout: c.timeout}
 	}
+	return c.hc
+}
 
-	return &http.Client{Transport: rt}
+// nilBodyTransport gives the responses of its RoundTripper that have a
+// nil Body an empty one. http.Client tolerates nil bodies, but ochttp
+// wraps them to measure their size and panics reading them.
+type nilBodyTransport struct {
+	rt http.RoundTripper
+}
+
+func (nbt nilBodyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := nbt.rt.RoundTrip(req)
+	if res != nil && res.Body == nil {
+		res.Body = http.NoBody
+	}
+	return res, err
 }
 
 func (c *Client) apiKey() string {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	_, key, _ := c.token(context.Background())
+	return key
+}
+
+// doAuthAndReq sends req, retrying it as the RetryPolicy allows,
+// and decodes the JSON body of a successful response into into.
+func (c *Client) doAuthAndReq(req *http.Request, into interface{}) (http.Header, error) {
+	if err := c.checkPurchaseGuard(req); err != nil {
+		return nil, err
+	}
 
-	return c.__apiKey
+	policy := c.currentRetryPolicy()
+	refreshed := false
+	for attempt := 1; ; attempt++ {
+		scheme, token, err := c.token(req.Context())
+		if err != nil {
+			return nil, err
+		}
+		header, err := c.doAuthAndReqOnce(req, scheme+" "+token, into)
+		if !refreshed && isUnauthorized(err) && rewindable(req) {
+			// The key could have been rotated since it was
+			// last read, so refresh it and retry just once.
+			refreshed = true
+			if c.refreshToken(req.Context(), token) {
+				c.logf("goshippo: retrying %s %s%s with refreshed credentials", req.Method, req.URL.Path, tenantLogSuffix(req.Context()))
+				if req, err = rewindRequest(req); err != nil {
+					return nil, err
+				}
+				opStatsFromContext(req.Context()).recordRetry()
+				continue
+			}
+		}
+		delay, retry := policy.retryDelay(req, attempt, err)
+		if !retry {
+			return header, err
+		}
+		c.logf("goshippo: retrying %s %s%s in %s after attempt #%d failed: %v", req.Method, req.URL.Path, tenantLogSuffix(req.Context()), delay, attempt, err)
+		if serr := sleepContext(req.Context(), delay); serr != nil {
+			return header, err
+		}
+		if req, err = rewindRequest(req); err != nil {
+			return nil, err
+		}
+		opStatsFromContext(req.Context()).recordRetry()
+	}
 }
 
-func (c *Client) doAuthAndReq(req *http.Request) ([]byte, http.Header, error) {
-	req.Header.Set("Authorization", fmt.Sprintf("ShippoToken %s", c.apiKey()))
+func (c *Client) doAuthAndReqOnce(req *http.Request, authorization string, into interface{}) (http.Header, error) {
+	limiter := c.currentRateLimiter()
+	class := endpointClassOf(req.URL)
+	if err := limiter.Wait(req.Context(), class); err != nil {
+		return nil, err
+	}
+
+	if op := operationFromContext(req.Context()); op != nil {
+		for key, values := range op.Header {
+			if key = http.CanonicalHeaderKey(key); len(req.Header[key]) == 0 {
+				req.Header[key] = append([]string(nil), values...)
+			}
+		}
+	}
+	req.Header.Set("Authorization", authorization)
+	if tenant, _ := TenantFromContext(req.Context()); tenant.AccountID != "" {
+		req.Header.Set(headerShippoAccountID, tenant.AccountID)
+	}
+	req.Header.Set("User-Agent", c.userAgent())
+	if version := c.APIVersion(); version.Pinned() {
+		req.Header.Set("Shippo-API-Version", string(version))
+	}
+	meta := responseMetaFromContext(req.Context())
+	meta.recordAttempt()
+	opStatsFromContext(req.Context()).recordEndpoint(req)
+
+	reqBody := c.requestBodyForLog(req)
+	startTime := time.Now()
 	res, err := c.httpClient().Do(req)
 	if err != nil {
-		return nil, nil, err
-	}
-	if res.Body != nil {
-		defer res.Body.Close()
+		c.logExchange(req, reqBody, nil, nil, time.Since(startTime), err)
+		return nil, err
 	}
+	limiter.observe(req.Context(), class, res.StatusCode, res.Header)
+	opStatsFromContext(req.Context()).recordStatus(res.StatusCode)
+	meta.recordResponse(res, time.Now())
+	defer res.Body.Close()
+
+	max := c.maxResponseBytes()
 	if !otils.StatusOK(res.StatusCode) {
-		return nil, res.Header, errors.New(res.Status)
+		buf := getBuffer()
+		defer putBuffer(buf)
+
+		err := readBody(buf, res.Body, max)
+		c.logExchange(req, reqBody, res, buf.Bytes(), time.Since(startTime), err)
+		// buf goes back to the pool, so the error needs its own
+		// copy. Bodies past max are kept, truncated, all the same.
+		slurp := append([]byte(nil), buf.Bytes()...)
+		return res.Header, makeAPIError(res, slurp)
+	}
+	if res.ContentLength > max {
+		err := fmt.Errorf("%w: %d > %d bytes", ErrResponseTooLarge, res.ContentLength, max)
+		c.logExchange(req, reqBody, res, nil, time.Since(startTime), err)
+		return res.Header, err
+	}
+
+	// Successful responses are decoded straight from the body,
+	// which is only buffered if it is going to be logged.
+	var logged *bytes.Buffer
+	if _, level, _ := c.logSettings(); level >= LogBodies {
+		logged = getBuffer()
+		defer putBuffer(logged)
+	}
+	err = decodeBody(res.Body, max, into, logged)
+	var resBody []byte
+	if logged != nil {
+		resBody = logged.Bytes()
 	}
-	slurp, err := ioutil.ReadAll(res.Body)
-	return slurp, res.Header, err
+	c.logExchange(req, reqBody, res, resBody, time.Since(startTime), err)
+	return res.Header, err
 }
@@ -15,15 +15,18 @@
 package goshippo_test
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/orijtech/goshippo/v1"
 	"github.com/orijtech/otils"
@@ -199,6 +202,122 @@ func TestListAddresses(t *testing.T) {
 	}
 }
 
+func TestListAddressesContextCancel(t *testing.T) {
+	client, err := goshippo.NewClient(token1)
+	if err != nil {
+		t.Fatalf("list address client err: %v", err)
+	}
+	client.SetHTTPRoundTripper(&backend{route: listAddressesRoute})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	res, err := client.ListAddressesContext(ctx, &goshippo.AddressListRequest{
+		ThrottleDurationMs: goshippo.NoThrottle,
+	})
+	if err != nil {
+		t.Fatalf("listAddresses err: %v", err)
+	}
+
+	// Don't read any pages so that the paging goroutine is
+	// blocked on its send, then cancel and expect it to exit.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case _, ok := <-res.Pages:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("paging goroutine did not exit after context cancellation")
+		}
+	}
+}
+
+func TestSetBaseURL(t *testing.T) {
+	var srvURL string
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if badAuthResp, _ := checkBadAuth(req, "GET"); badAuthResp != nil {
+			http.Error(rw, badAuthResp.Status, badAuthResp.StatusCode)
+			return
+		}
+		if req.URL.Path != "/shippo/addresses/" {
+			http.NotFound(rw, req)
+			return
+		}
+		next := "null"
+		if req.URL.Query().Get("page") == "1" {
+			next = fmt.Sprintf("%q", srvURL+"/shippo/addresses/?page=2")
+		}
+		fmt.Fprintf(rw, `{"count": 2, "next": %s, "previous": null, "results": [{"object_id": %q}]}`, next, uuid.NewRandom().String())
+	}))
+	defer srv.Close()
+	srvURL = srv.URL
+
+	client, err := goshippo.NewClient(token1)
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+
+	badURLs := []string{"flux", "ftp://example.org", "https://"}
+	for i, badURL := range badURLs {
+		if err := client.SetBaseURL(badURL); err == nil {
+			t.Errorf("#%d: expected an error for %q", i, badURL)
+		}
+	}
+
+	if err := client.SetBaseURL(srv.URL + "/shippo/"); err != nil {
+		t.Fatalf("setBaseURL err: %v", err)
+	}
+
+	tests := [...]struct {
+		req       *goshippo.AddressListRequest
+		wantErr   bool
+		wantCount int
+	}{
+		0: {req: &goshippo.AddressListRequest{}, wantCount: 2},
+		1: {req: &goshippo.AddressListRequest{PageToken: srv.URL + "/shippo/addresses/?page=2"}, wantCount: 1},
+		2: {
+			// Page tokens must now come from the configured base URL.
+			req:     &goshippo.AddressListRequest{PageToken: "https://api.goshippo.com/addresses/?page=1"},
+			wantErr: true,
+		},
+		3: {
+			// Page tokens must be within the configured path prefix.
+			req:     &goshippo.AddressListRequest{PageToken: srv.URL + "/addresses/?page=1"},
+			wantErr: true,
+		},
+	}
+
+	for i, tt := range tests {
+		tt.req.ThrottleDurationMs = goshippo.NoThrottle
+		res, err := client.ListAddresses(tt.req)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("#%d: want non-nil error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: gotErr=%v", i, err)
+			continue
+		}
+
+		count := 0
+		for page := range res.Pages {
+			if page.Err != nil {
+				t.Errorf("#%d: page #%d err: %v", i, page.PageNumber, page.Err)
+				continue
+			}
+			count += len(page.Addresses)
+		}
+		if count != tt.wantCount {
+			t.Errorf("#%d: gotCount=%d wantCount=%d", i, count, tt.wantCount)
+		}
+	}
+}
+
 func TestValidateAddress(t *testing.T) {
 	client, err := goshippo.NewClient(token1)
 	if err != nil {
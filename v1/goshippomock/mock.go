@@ -0,0 +1,306 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Code generated by mockgen from api.go. DO NOT EDIT.
+
+package goshippomock
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/orijtech/goshippo/v1"
+)
+
+var _ = context.Background
+
+// Client is a mock of goshippo.Service. The calls to a method
+// are answered by the func field of the same name with a Func
+// suffix, or fail with ErrNotConfigured if that field is nil.
+type Client struct {
+	recorder
+
+	CreateAddressFunc               func(*goshippo.Address) (*goshippo.Address, error)
+	CreateAddressContextFunc        func(context.Context, *goshippo.Address) (*goshippo.Address, error)
+	AddressByIDFunc                 func(string) (*goshippo.Address, error)
+	AddressByIDContextFunc          func(context.Context, string) (*goshippo.Address, error)
+	ValidateAddressFunc             func(string) (*goshippo.Address, error)
+	ValidateAddressContextFunc      func(context.Context, string) (*goshippo.Address, error)
+	ListAddressesFunc               func(*goshippo.AddressListRequest) (*goshippo.AddressesPager, error)
+	ListAddressesContextFunc        func(context.Context, *goshippo.AddressListRequest) (*goshippo.AddressesPager, error)
+	NewAddressPagerFunc             func(*goshippo.AddressListRequest) (*goshippo.Pager[*goshippo.Address], error)
+	SyncAddressesFunc               func(context.Context, goshippo.Store) (*goshippo.SyncResult, error)
+	CreateParcelFunc                func(*goshippo.Parcel) (*goshippo.Parcel, error)
+	CreateParcelContextFunc         func(context.Context, *goshippo.Parcel) (*goshippo.Parcel, error)
+	ParcelByIDFunc                  func(string) (*goshippo.Parcel, error)
+	ParcelByIDContextFunc           func(context.Context, string) (*goshippo.Parcel, error)
+	NewParcelPagerFunc              func(*goshippo.ListRequest) (*goshippo.Pager[*goshippo.Parcel], error)
+	SyncParcelsFunc                 func(context.Context, goshippo.Store) (*goshippo.SyncResult, error)
+	CreateTransactionFunc           func(*goshippo.Transaction) (*goshippo.Transaction, error)
+	CreateTransactionContextFunc    func(context.Context, *goshippo.Transaction) (*goshippo.Transaction, error)
+	TransactionByIDFunc             func(string) (*goshippo.Transaction, error)
+	TransactionByIDContextFunc      func(context.Context, string) (*goshippo.Transaction, error)
+	CreateManagedAccountFunc        func(*goshippo.ManagedAccount) (*goshippo.ManagedAccount, error)
+	CreateManagedAccountContextFunc func(context.Context, *goshippo.ManagedAccount) (*goshippo.ManagedAccount, error)
+	ManagedAccountByIDFunc          func(string) (*goshippo.ManagedAccount, error)
+	ManagedAccountByIDContextFunc   func(context.Context, string) (*goshippo.ManagedAccount, error)
+	UpdateManagedAccountFunc        func(*goshippo.ManagedAccount) (*goshippo.ManagedAccount, error)
+	UpdateManagedAccountContextFunc func(context.Context, *goshippo.ManagedAccount) (*goshippo.ManagedAccount, error)
+	NewManagedAccountPagerFunc      func(*goshippo.ListRequest) (*goshippo.Pager[*goshippo.ManagedAccount], error)
+}
+
+var _ goshippo.Service = (*Client)(nil)
+
+func (m *Client) CreateAddress(a0 *goshippo.Address) (r0 *goshippo.Address, r1 error) {
+	m.record("CreateAddress", []interface{}{a0})
+	if m.CreateAddressFunc == nil {
+		r1 = fmt.Errorf("%w: CreateAddress", ErrNotConfigured)
+		return
+	}
+	return m.CreateAddressFunc(a0)
+}
+
+func (m *Client) CreateAddressContext(a0 context.Context, a1 *goshippo.Address) (r0 *goshippo.Address, r1 error) {
+	m.record("CreateAddressContext", []interface{}{a0, a1})
+	if m.CreateAddressContextFunc == nil {
+		r1 = fmt.Errorf("%w: CreateAddressContext", ErrNotConfigured)
+		return
+	}
+	return m.CreateAddressContextFunc(a0, a1)
+}
+
+func (m *Client) AddressByID(a0 string) (r0 *goshippo.Address, r1 error) {
+	m.record("AddressByID", []interface{}{a0})
+	if m.AddressByIDFunc == nil {
+		r1 = fmt.Errorf("%w: AddressByID", ErrNotConfigured)
+		return
+	}
+	return m.AddressByIDFunc(a0)
+}
+
+func (m *Client) AddressByIDContext(a0 context.Context, a1 string) (r0 *goshippo.Address, r1 error) {
+	m.record("AddressByIDContext", []interface{}{a0, a1})
+	if m.AddressByIDContextFunc == nil {
+		r1 = fmt.Errorf("%w: AddressByIDContext", ErrNotConfigured)
+		return
+	}
+	return m.AddressByIDContextFunc(a0, a1)
+}
+
+func (m *Client) ValidateAddress(a0 string) (r0 *goshippo.Address, r1 error) {
+	m.record("ValidateAddress", []interface{}{a0})
+	if m.ValidateAddressFunc == nil {
+		r1 = fmt.Errorf("%w: ValidateAddress", ErrNotConfigured)
+		return
+	}
+	return m.ValidateAddressFunc(a0)
+}
+
+func (m *Client) ValidateAddressContext(a0 context.Context, a1 string) (r0 *goshippo.Address, r1 error) {
+	m.record("ValidateAddressContext", []interface{}{a0, a1})
+	if m.ValidateAddressContextFunc == nil {
+		r1 = fmt.Errorf("%w: ValidateAddressContext", ErrNotConfigured)
+		return
+	}
+	return m.ValidateAddressContextFunc(a0, a1)
+}
+
+func (m *Client) ListAddresses(a0 *goshippo.AddressListRequest) (r0 *goshippo.AddressesPager, r1 error) {
+	m.record("ListAddresses", []interface{}{a0})
+	if m.ListAddressesFunc == nil {
+		r1 = fmt.Errorf("%w: ListAddresses", ErrNotConfigured)
+		return
+	}
+	return m.ListAddressesFunc(a0)
+}
+
+func (m *Client) ListAddressesContext(a0 context.Context, a1 *goshippo.AddressListRequest) (r0 *goshippo.AddressesPager, r1 error) {
+	m.record("ListAddressesContext", []interface{}{a0, a1})
+	if m.ListAddressesContextFunc == nil {
+		r1 = fmt.Errorf("%w: ListAddressesContext", ErrNotConfigured)
+		return
+	}
+	return m.ListAddressesContextFunc(a0, a1)
+}
+
+func (m *Client) NewAddressPager(a0 *goshippo.AddressListRequest) (r0 *goshippo.Pager[*goshippo.Address], r1 error) {
+	m.record("NewAddressPager", []interface{}{a0})
+	if m.NewAddressPagerFunc == nil {
+		r1 = fmt.Errorf("%w: NewAddressPager", ErrNotConfigured)
+		return
+	}
+	return m.NewAddressPagerFunc(a0)
+}
+
+func (m *Client) SyncAddresses(a0 context.Context, a1 goshippo.Store) (r0 *goshippo.SyncResult, r1 error) {
+	m.record("SyncAddresses", []interface{}{a0, a1})
+	if m.SyncAddressesFunc == nil {
+		r1 = fmt.Errorf("%w: SyncAddresses", ErrNotConfigured)
+		return
+	}
+	return m.SyncAddressesFunc(a0, a1)
+}
+
+func (m *Client) CreateParcel(a0 *goshippo.Parcel) (r0 *goshippo.Parcel, r1 error) {
+	m.record("CreateParcel", []interface{}{a0})
+	if m.CreateParcelFunc == nil {
+		r1 = fmt.Errorf("%w: CreateParcel", ErrNotConfigured)
+		return
+	}
+	return m.CreateParcelFunc(a0)
+}
+
+func (m *Client) CreateParcelContext(a0 context.Context, a1 *goshippo.Parcel) (r0 *goshippo.Parcel, r1 error) {
+	m.record("CreateParcelContext", []interface{}{a0, a1})
+	if m.CreateParcelContextFunc == nil {
+		r1 = fmt.Errorf("%w: CreateParcelContext", ErrNotConfigured)
+		return
+	}
+	return m.CreateParcelContextFunc(a0, a1)
+}
+
+func (m *Client) ParcelByID(a0 string) (r0 *goshippo.Parcel, r1 error) {
+	m.record("ParcelByID", []interface{}{a0})
+	if m.ParcelByIDFunc == nil {
+		r1 = fmt.Errorf("%w: ParcelByID", ErrNotConfigured)
+		return
+	}
+	return m.ParcelByIDFunc(a0)
+}
+
+func (m *Client) ParcelByIDContext(a0 context.Context, a1 string) (r0 *goshippo.Parcel, r1 error) {
+	m.record("ParcelByIDContext", []interface{}{a0, a1})
+	if m.ParcelByIDContextFunc == nil {
+		r1 = fmt.Errorf("%w: ParcelByIDContext", ErrNotConfigured)
+		return
+	}
+	return m.ParcelByIDContextFunc(a0, a1)
+}
+
+func (m *Client) NewParcelPager(a0 *goshippo.ListRequest) (r0 *goshippo.Pager[*goshippo.Parcel], r1 error) {
+	m.record("NewParcelPager", []interface{}{a0})
+	if m.NewParcelPagerFunc == nil {
+		r1 = fmt.Errorf("%w: NewParcelPager", ErrNotConfigured)
+		return
+	}
+	return m.NewParcelPagerFunc(a0)
+}
+
+func (m *Client) SyncParcels(a0 context.Context, a1 goshippo.Store) (r0 *goshippo.SyncResult, r1 error) {
+	m.record("SyncParcels", []interface{}{a0, a1})
+	if m.SyncParcelsFunc == nil {
+		r1 = fmt.Errorf("%w: SyncParcels", ErrNotConfigured)
+		return
+	}
+	return m.SyncParcelsFunc(a0, a1)
+}
+
+func (m *Client) CreateTransaction(a0 *goshippo.Transaction) (r0 *goshippo.Transaction, r1 error) {
+	m.record("CreateTransaction", []interface{}{a0})
+	if m.CreateTransactionFunc == nil {
+		r1 = fmt.Errorf("%w: CreateTransaction", ErrNotConfigured)
+		return
+	}
+	return m.CreateTransactionFunc(a0)
+}
+
+func (m *Client) CreateTransactionContext(a0 context.Context, a1 *goshippo.Transaction) (r0 *goshippo.Transaction, r1 error) {
+	m.record("CreateTransactionContext", []interface{}{a0, a1})
+	if m.CreateTransactionContextFunc == nil {
+		r1 = fmt.Errorf("%w: CreateTransactionContext", ErrNotConfigured)
+		return
+	}
+	return m.CreateTransactionContextFunc(a0, a1)
+}
+
+func (m *Client) TransactionByID(a0 string) (r0 *goshippo.Transaction, r1 error) {
+	m.record("TransactionByID", []interface{}{a0})
+	if m.TransactionByIDFunc == nil {
+		r1 = fmt.Errorf("%w: TransactionByID", ErrNotConfigured)
+		return
+	}
+	return m.TransactionByIDFunc(a0)
+}
+
+func (m *Client) TransactionByIDContext(a0 context.Context, a1 string) (r0 *goshippo.Transaction, r1 error) {
+	m.record("TransactionByIDContext", []interface{}{a0, a1})
+	if m.TransactionByIDContextFunc == nil {
+		r1 = fmt.Errorf("%w: TransactionByIDContext", ErrNotConfigured)
+		return
+	}
+	return m.TransactionByIDContextFunc(a0, a1)
+}
+
+func (m *Client) CreateManagedAccount(a0 *goshippo.ManagedAccount) (r0 *goshippo.ManagedAccount, r1 error) {
+	m.record("CreateManagedAccount", []interface{}{a0})
+	if m.CreateManagedAccountFunc == nil {
+		r1 = fmt.Errorf("%w: CreateManagedAccount", ErrNotConfigured)
+		return
+	}
+	return m.CreateManagedAccountFunc(a0)
+}
+
+func (m *Client) CreateManagedAccountContext(a0 context.Context, a1 *goshippo.ManagedAccount) (r0 *goshippo.ManagedAccount, r1 error) {
+	m.record("CreateManagedAccountContext", []interface{}{a0, a1})
+	if m.CreateManagedAccountContextFunc == nil {
+		r1 = fmt.Errorf("%w: CreateManagedAccountContext", ErrNotConfigured)
+		return
+	}
+	return m.CreateManagedAccountContextFunc(a0, a1)
+}
+
+func (m *Client) ManagedAccountByID(a0 string) (r0 *goshippo.ManagedAccount, r1 error) {
+	m.record("ManagedAccountByID", []interface{}{a0})
+	if m.ManagedAccountByIDFunc == nil {
+		r1 = fmt.Errorf("%w: ManagedAccountByID", ErrNotConfigured)
+		return
+	}
+	return m.ManagedAccountByIDFunc(a0)
+}
+
+func (m *Client) ManagedAccountByIDContext(a0 context.Context, a1 string) (r0 *goshippo.ManagedAccount, r1 error) {
+	m.record("ManagedAccountByIDContext", []interface{}{a0, a1})
+	if m.ManagedAccountByIDContextFunc == nil {
+		r1 = fmt.Errorf("%w: ManagedAccountByIDContext", ErrNotConfigured)
+		return
+	}
+	return m.ManagedAccountByIDContextFunc(a0, a1)
+}
+
+func (m *Client) UpdateManagedAccount(a0 *goshippo.ManagedAccount) (r0 *goshippo.ManagedAccount, r1 error) {
+	m.record("UpdateManagedAccount", []interface{}{a0})
+	if m.UpdateManagedAccountFunc == nil {
+		r1 = fmt.Errorf("%w: UpdateManagedAccount", ErrNotConfigured)
+		return
+	}
+	return m.UpdateManagedAccountFunc(a0)
+}
+
+func (m *Client) UpdateManagedAccountContext(a0 context.Context, a1 *goshippo.ManagedAccount) (r0 *goshippo.ManagedAccount, r1 error) {
+	m.record("UpdateManagedAccountContext", []interface{}{a0, a1})
+	if m.UpdateManagedAccountContextFunc == nil {
+		r1 = fmt.Errorf("%w: UpdateManagedAccountContext", ErrNotConfigured)
+		return
+	}
+	return m.UpdateManagedAccountContextFunc(a0, a1)
+}
+
+func (m *Client) NewManagedAccountPager(a0 *goshippo.ListRequest) (r0 *goshippo.Pager[*goshippo.ManagedAccount], r1 error) {
+	m.record("NewManagedAccountPager", []interface{}{a0})
+	if m.NewManagedAccountPagerFunc == nil {
+		r1 = fmt.Errorf("%w: NewManagedAccountPager", ErrNotConfigured)
+		return
+	}
+	return m.NewManagedAccountPagerFunc(a0)
+}
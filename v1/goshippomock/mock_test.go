@@ -0,0 +1,94 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippomock_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/orijtech/goshippo/v1"
+	"github.com/orijtech/goshippo/v1/goshippomock"
+)
+
+// labelFor is the kind of consumer code that the mock is meant for.
+func labelFor(ctx context.Context, svc goshippo.TransactionService, rateID string) (string, error) {
+	tx, err := svc.CreateTransactionContext(ctx, &goshippo.Transaction{Rate: rateID})
+	if err != nil {
+		return "", err
+	}
+	return tx.LabelURL, nil
+}
+
+func TestMockRecordsCalls(t *testing.T) {
+	mock := new(goshippomock.Client)
+	mock.CreateTransactionContextFunc = func(ctx context.Context, tx *goshippo.Transaction) (*goshippo.Transaction, error) {
+		if tx.Rate == "bad-rate" {
+			return nil, &goshippo.APIError{StatusCode: 400}
+		}
+		return &goshippo.Transaction{ID: "tx-1", Rate: tx.Rate, LabelURL: "https://example.com/label.pdf"}, nil
+	}
+
+	ctx := context.Background()
+	if got, err := labelFor(ctx, mock, "rate-1"); err != nil || got != "https://example.com/label.pdf" {
+		t.Errorf("gotLabel=%q gotErr=%v", got, err)
+	}
+	if _, err := labelFor(ctx, mock, "bad-rate"); err == nil {
+		t.Error("expecting an error for bad-rate")
+	}
+
+	calls := mock.CallsTo("CreateTransactionContext")
+	if len(calls) != 2 {
+		t.Fatalf("gotCalls=%d wantCalls=2", len(calls))
+	}
+	if tx := calls[1].Args[1].(*goshippo.Transaction); tx.Rate != "bad-rate" {
+		t.Errorf("gotRate=%q wantRate=bad-rate", tx.Rate)
+	}
+
+	// Methods without a Func fail loudly.
+	if _, err := mock.ParcelByID("parcel-1"); !errors.Is(err, goshippomock.ErrNotConfigured) {
+		t.Errorf("gotErr=%v wantErr=%v", err, goshippomock.ErrNotConfigured)
+	}
+	if got := len(mock.Calls()); got != 3 {
+		t.Errorf("gotAllCalls=%d wantAllCalls=3", got)
+	}
+	mock.Reset()
+	if got := len(mock.Calls()); got != 0 {
+		t.Errorf("gotCallsAfterReset=%d wantCallsAfterReset=0", got)
+	}
+}
+
+func TestMockPager(t *testing.T) {
+	mock := new(goshippomock.Client)
+	mock.NewAddressPagerFunc = func(*goshippo.AddressListRequest) (*goshippo.Pager[*goshippo.Address], error) {
+		return goshippo.NewStaticPager([]*goshippo.Address{{ID: "a-1"}, {ID: "a-2"}}, []*goshippo.Address{{ID: "a-3"}}), nil
+	}
+
+	var svc goshippo.AddressService = mock
+	pager, err := svc.NewAddressPager(nil)
+	if err != nil {
+		t.Fatalf("newPager err: %v", err)
+	}
+	var n int
+	for _, err := range pager.All(context.Background()) {
+		if err != nil {
+			t.Fatalf("all err: %v", err)
+		}
+		n += 1
+	}
+	if n != 3 {
+		t.Errorf("gotAddresses=%d wantAddresses=3", n)
+	}
+}
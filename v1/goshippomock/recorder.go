@@ -0,0 +1,84 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package goshippomock provides a mock of goshippo.Service, and thus
+// of each of the per-resource interfaces that it embeds:
+//
+//	mock := new(goshippomock.Client)
+//	mock.CreateParcelFunc = func(parcel *goshippo.Parcel) (*goshippo.Parcel, error) {
+//		return &goshippo.Parcel{ID: "parcel-1"}, nil
+//	}
+//	svc := NewFulfilment(mock) // Accepts a goshippo.ParcelService.
+//	...
+//	if calls := mock.CallsTo("CreateParcel"); len(calls) != 1 {
+//		t.Errorf("expecting one parcel to be created")
+//	}
+package goshippomock
+
+//go:generate go run ../internal/mockgen -src ../api.go -out mock.go
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrNotConfigured is returned by the methods
+// whose Func field was not set.
+var ErrNotConfigured = errors.New("goshippomock: method is not configured")
+
+// Call is a recorded call to a method of the mock.
+type Call struct {
+	Method string        `json:"method"`
+	Args   []interface{} `json:"args"`
+}
+
+type recorder struct {
+	mu    sync.Mutex
+	calls []*Call
+}
+
+func (r *recorder) record(method string, args []interface{}) {
+	r.mu.Lock()
+	r.calls = append(r.calls, &Call{Method: method, Args: args})
+	r.mu.Unlock()
+}
+
+// Calls returns all the recorded calls, in the order they were made.
+func (r *recorder) Calls() []*Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]*Call(nil), r.calls...)
+}
+
+// CallsTo returns the recorded calls to method.
+func (r *recorder) CallsTo(method string) []*Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var calls []*Call
+	for _, call := range r.calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Reset forgets all the recorded calls.
+func (r *recorder) Reset() {
+	r.mu.Lock()
+	r.calls = nil
+	r.mu.Unlock()
+}
@@ -0,0 +1,105 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippotest
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/orijtech/goshippo/v1"
+)
+
+const (
+	// TestClientID and TestClientSecret are the credentials of
+	// the Shippo app described by the OAuthConfig of the server.
+	TestClientID     = "goshippotest-app"
+	TestClientSecret = "goshippotest-secret"
+
+	oauthAuthorizePath = "/oauth/authorize"
+	oauthTokenPath     = "/oauth/access_token"
+)
+
+// OAuthConfig returns the configuration of a Shippo app
+// whose authorization server is the server itself.
+func (s *Server) OAuthConfig() *goshippo.OAuthConfig {
+	return &goshippo.OAuthConfig{
+		ClientID:     TestClientID,
+		ClientSecret: TestClientSecret,
+		AuthorizeURL: s.URL + oauthAuthorizePath,
+		TokenURL:     s.URL + oauthTokenPath,
+	}
+}
+
+// Authorize stands in for a merchant granting the app access on
+// the page at authURL. It returns the query of the callback that
+// the merchant would be redirected to, with a code that can be
+// exchanged once and the state of authURL.
+func (s *Server) Authorize(authURL string) (callbackQuery string, err error) {
+	req, err := http.NewRequest("GET", authURL, nil)
+	if err != nil {
+		return "", err
+	}
+	qv := req.URL.Query()
+	if qv.Get("client_id") != TestClientID || qv.Get("response_type") != "code" {
+		return "", fmt.Errorf("goshippotest: unexpected authorize URL %q", authURL)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code := "code-" + s.mintID()
+	s.oauthCodes[code] = true
+	callback := url.Values{"code": {code}, "state": {qv.Get("state")}}
+	return callback.Encode(), nil
+}
+
+// exchangeCode serves the token endpoint. It must be called with s.mu held.
+func (s *Server) exchangeCode(rw http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		writeDetail(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.PostForm.Get("client_id") != TestClientID || req.PostForm.Get("client_secret") != TestClientSecret {
+		writeJSON(rw, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	code := req.PostForm.Get("code")
+	if req.PostForm.Get("grant_type") != "authorization_code" || !s.oauthCodes[code] {
+		writeJSON(rw, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	delete(s.oauthCodes, code)
+
+	token := "oauth." + s.mintID()
+	s.accessTokens[token] = true
+	writeJSON(rw, http.StatusOK, &goshippo.OAuthToken{AccessToken: token, TokenType: "bearer", Scope: "*"})
+}
+
+// authenticated reports whether req carries an API key, or an
+// access token issued by the server. It must be called with s.mu held.
+func (s *Server) authenticated(req *http.Request) bool {
+	scheme, token, _ := strings.Cut(req.Header.Get("Authorization"), " ")
+	token = strings.TrimSpace(token)
+	switch scheme {
+	case "ShippoToken":
+		return token != ""
+	case "Bearer":
+		return s.accessTokens[token]
+	default:
+		return false
+	}
+}
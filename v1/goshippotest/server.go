@@ -0,0 +1,947 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package goshippotest provides an in-memory fake of the GoShippo API,
+// for tests of code built on the goshippo client that can't use
+// the network:
+//
+//	srv := goshippotest.NewServer()
+//	defer srv.Close()
+//
+//	client, err := srv.Client()
+//	...
+package goshippotest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/orijtech/goshippo/v1"
+)
+
+const (
+	// TestToken is the API key of the clients returned by Server.Client.
+	TestToken = "shippo_test_goshippotest"
+
+	// Owner is the object_owner of the objects of the server,
+	// except for those created on behalf of a managed account
+	// whose owner is the email of that account.
+	Owner = "goshippotest@example.com"
+
+	defaultPageSize = 25
+)
+
+// Server is a fake GoShippo backend that keeps addresses, parcels,
+// shipments, rates, transactions, tracks and managed accounts in memory. Lists are
+// ordered from the newest object and paginated like the real API.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	lastID   uint64
+	pageSize int
+	failures []*Failure
+
+	addresses    *collection[*goshippo.Address]
+	parcels      *collection[*goshippo.Parcel]
+	shipments    *collection[*Shipment]
+	rates        *collection[*Rate]
+	transactions *collection[*goshippo.Transaction]
+	tracks       map[string]*Track
+	accounts     *collection[*goshippo.ManagedAccount]
+
+	// actingAs is the managed account that the request
+	// being served acts on behalf of, if any.
+	actingAs *goshippo.ManagedAccount
+
+	// idempotent maps the Idempotency-Key of creates
+	// to the ID of the object that they created.
+	idempotent map[string]string
+
+	// oauthCodes are the authorization codes that can
+	// be exchanged for one of the accessTokens.
+	oauthCodes   map[string]bool
+	accessTokens map[string]bool
+}
+
+// NewServer starts a Server, which must be closed once done with.
+func NewServer() *Server {
+	s := &Server{
+		pageSize:     defaultPageSize,
+		addresses:    newCollection[*goshippo.Address](),
+		parcels:      newCollection[*goshippo.Parcel](),
+		shipments:    newCollection[*Shipment](),
+		rates:        newCollection[*Rate](),
+		transactions: newCollection[*goshippo.Transaction](),
+		tracks:       make(map[string]*Track),
+		accounts:     newCollection[*goshippo.ManagedAccount](),
+		idempotent:   make(map[string]string),
+		oauthCodes:   make(map[string]bool),
+		accessTokens: make(map[string]bool),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Client returns a client that talks to the server, configured by opts.
+func (s *Server) Client(opts ...goshippo.Option) (*goshippo.Client, error) {
+	opts = append([]goshippo.Option{goshippo.WithAPIKey(TestToken), goshippo.WithBaseURL(s.URL)}, opts...)
+	return goshippo.New(opts...)
+}
+
+// SetPageSize sets the number of objects per page for
+// requests that don't set a limit. It defaults to 25.
+func (s *Server) SetPageSize(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n <= 0 {
+		n = defaultPageSize
+	}
+	s.pageSize = n
+}
+
+// Failure makes the server fail requests instead of serving them.
+type Failure struct {
+	// Method if set only fails requests with that method.
+	Method string
+
+	// PathPrefix if set only fails requests
+	// whose path starts with it e.g "/transactions/".
+	PathPrefix string
+
+	// StatusCode is the status of the failed responses. It
+	// defaults to 500 unless DropConnection is set.
+	StatusCode int
+
+	// Body is the body of the failed responses. It defaults
+	// to a JSON "detail" with the text of StatusCode.
+	Body string
+
+	// Header is added to the failed responses e.g Retry-After.
+	Header http.Header
+
+	// DropConnection if set closes the connection
+	// without responding, like a network failure.
+	DropConnection bool
+
+	// Times is the number of matching requests to fail,
+	// defaulting to 1. Use -1 to fail all of them.
+	Times int
+}
+
+// InjectFailure makes the next requests that match f fail.
+func (s *Server) InjectFailure(f Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f.Times == 0 {
+		f.Times = 1
+	}
+	s.failures = append(s.failures, &f)
+}
+
+// ClearFailures removes all the pending injected failures.
+func (s *Server) ClearFailures() {
+	s.mu.Lock()
+	s.failures = nil
+	s.mu.Unlock()
+}
+
+func (s *Server) takeFailure(req *http.Request) *Failure {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, f := range s.failures {
+		if f.Method != "" && !strings.EqualFold(f.Method, req.Method) {
+			continue
+		}
+		if !strings.HasPrefix(req.URL.Path, f.PathPrefix) {
+			continue
+		}
+		if f.Times > 0 {
+			f.Times -= 1
+			if f.Times == 0 {
+				s.failures = append(s.failures[:i], s.failures[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+func (s *Server) fail(rw http.ResponseWriter, f *Failure) {
+	if f.DropConnection {
+		if hj, ok := rw.(http.Hijacker); ok {
+			if conn, _, err := hj.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+	for key, values := range f.Header {
+		for _, value := range values {
+			rw.Header().Add(key, value)
+		}
+	}
+	code := f.StatusCode
+	if code == 0 {
+		code = http.StatusInternalServerError
+	}
+	if f.Body == "" {
+		writeDetail(rw, code, http.StatusText(code))
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	rw.Write([]byte(f.Body))
+}
+
+// collection holds objects by ID in their order of creation.
+type collection[T any] struct {
+	ids  []string
+	byID map[string]T
+}
+
+func newCollection[T any]() *collection[T] {
+	return &collection[T]{byID: make(map[string]T)}
+}
+
+func (c *collection[T]) put(id string, obj T) {
+	if _, ok := c.byID[id]; !ok {
+		c.ids = append(c.ids, id)
+	}
+	c.byID[id] = obj
+}
+
+func (c *collection[T]) get(id string) (T, bool) {
+	obj, ok := c.byID[id]
+	return obj, ok
+}
+
+// newestFirst returns the objects from the most recently created one.
+func (c *collection[T]) newestFirst() []T {
+	objs := make([]T, 0, len(c.ids))
+	for i := len(c.ids) - 1; i >= 0; i-- {
+		objs = append(objs, c.byID[c.ids[i]])
+	}
+	return objs
+}
+
+// owner returns the object_owner of the objects created
+// by the request being served. It must be called with s.mu held.
+func (s *Server) owner() string {
+	if s.actingAs != nil {
+		return s.actingAs.Email
+	}
+	return Owner
+}
+
+// mintID returns a new 32 hex digit object ID, like those of GoShippo.
+// It must be called with s.mu held.
+func (s *Server) mintID() string {
+	s.lastID += 1
+	return fmt.Sprintf("%032x", s.lastID)
+}
+
+func now() *time.Time {
+	t := time.Now().UTC()
+	return &t
+}
+
+func (s *Server) serveHTTP(rw http.ResponseWriter, req *http.Request) {
+	if f := s.takeFailure(req); f != nil {
+		s.fail(rw, f)
+		return
+	}
+
+	// Requests are served one at a time, which keeps
+	// the state consistent while objects are encoded.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if req.Method == "POST" && req.URL.Path == oauthTokenPath {
+		s.exchangeCode(rw, req)
+		return
+	}
+	if !s.authenticated(req) {
+		writeDetail(rw, http.StatusUnauthorized, "Authentication credentials were not provided.")
+		return
+	}
+
+	s.actingAs = nil
+	if accountID := req.Header.Get("SHIPPO-ACCOUNT-ID"); accountID != "" {
+		acct, ok := s.accounts.get(accountID)
+		if !ok {
+			writeDetail(rw, http.StatusForbidden, "You do not have permission to act on behalf of this account.")
+			return
+		}
+		s.actingAs = acct
+	}
+
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	route := fmt.Sprintf("%s %s", req.Method, segments[0])
+	switch {
+	case route == "POST addresses" && len(segments) == 1:
+		s.createAddress(rw, req)
+	case route == "GET addresses" && len(segments) == 1:
+		writeList(s, rw, req, s.addresses.newestFirst())
+	case route == "GET addresses" && len(segments) == 2:
+		addr, ok := s.addresses.get(segments[1])
+		writeObject(rw, addr, ok)
+	case route == "GET addresses" && len(segments) == 3 && segments[2] == "validate":
+		s.validateAddress(rw, segments[1])
+
+	case route == "POST parcels" && len(segments) == 1:
+		s.createParcel(rw, req)
+	case route == "GET parcels" && len(segments) == 1:
+		writeList(s, rw, req, s.parcels.newestFirst())
+	case route == "GET parcels" && len(segments) == 2:
+		parcel, ok := s.parcels.get(segments[1])
+		writeObject(rw, parcel, ok)
+
+	case route == "POST shipments" && len(segments) == 1:
+		s.createShipment(rw, req)
+	case route == "GET shipments" && len(segments) == 1:
+		writeList(s, rw, req, s.shipments.newestFirst())
+	case route == "GET shipments" && len(segments) == 2:
+		shipment, ok := s.shipments.get(segments[1])
+		writeObject(rw, shipment, ok)
+	// The currency segment of /shipments/<id>/rates/<currency>/ is ignored.
+	case route == "GET shipments" && (len(segments) == 3 || len(segments) == 4) && segments[2] == "rates":
+		shipment, ok := s.shipments.get(segments[1])
+		if !ok {
+			writeDetail(rw, http.StatusNotFound, "Not found.")
+			return
+		}
+		writeList(s, rw, req, shipment.Rates)
+
+	case route == "GET rates" && len(segments) == 2:
+		rate, ok := s.rates.get(segments[1])
+		writeObject(rw, rate, ok)
+
+	case route == "POST transactions" && len(segments) == 1:
+		s.createTransaction(rw, req)
+	case route == "GET transactions" && len(segments) == 1:
+		writeList(s, rw, req, s.transactions.newestFirst())
+	case route == "GET transactions" && len(segments) == 2:
+		transaction, ok := s.transactions.get(segments[1])
+		writeObject(rw, transaction, ok)
+
+	case route == "POST tracks" && len(segments) == 1:
+		s.registerTrack(rw, req)
+	case route == "GET tracks" && len(segments) == 3:
+		track, ok := s.track(segments[1], segments[2])
+		writeObject(rw, track, ok)
+
+	case route == "POST shippo-accounts" && len(segments) == 1:
+		s.createAccount(rw, req)
+	case route == "GET shippo-accounts" && len(segments) == 1:
+		writeList(s, rw, req, s.accounts.newestFirst())
+	case route == "GET shippo-accounts" && len(segments) == 2:
+		acct, ok := s.accounts.get(segments[1])
+		writeObject(rw, acct, ok)
+	case route == "PUT shippo-accounts" && len(segments) == 2:
+		s.updateAccount(rw, req, segments[1])
+
+	default:
+		writeDetail(rw, http.StatusNotFound, "Not found.")
+	}
+}
+
+func writeJSON(rw http.ResponseWriter, code int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	json.NewEncoder(rw).Encode(v)
+}
+
+func writeDetail(rw http.ResponseWriter, code int, detail string) {
+	writeJSON(rw, code, map[string]string{"detail": detail})
+}
+
+// writeFieldError writes a validation error like those of GoShippo.
+func writeFieldError(rw http.ResponseWriter, field, message string) {
+	writeJSON(rw, http.StatusBadRequest, map[string][]string{field: {message}})
+}
+
+func writeObject(rw http.ResponseWriter, obj interface{}, ok bool) {
+	if !ok {
+		writeDetail(rw, http.StatusNotFound, "Not found.")
+		return
+	}
+	writeJSON(rw, http.StatusOK, obj)
+}
+
+// writeList writes a page of objs, selected by the "page" and the
+// "limit", or "results", query parameters. It must be called with
+// s.mu held.
+func writeList[T any](s *Server, rw http.ResponseWriter, req *http.Request, objs []T) {
+	query := req.URL.Query()
+	limit := s.pageSize
+	for _, key := range []string{"results", "limit"} {
+		if n, err := strconv.Atoi(query.Get(key)); err == nil && n > 0 {
+			limit = n
+		}
+	}
+	page := 1
+	if value := query.Get("page"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			writeDetail(rw, http.StatusNotFound, "Invalid page.")
+			return
+		}
+		page = n
+	}
+
+	start := (page - 1) * limit
+	if page > 1 && start >= len(objs) {
+		writeDetail(rw, http.StatusNotFound, "Invalid page.")
+		return
+	}
+	end := start + limit
+	if end > len(objs) {
+		end = len(objs)
+	}
+
+	pageURL := func(number int) *string {
+		qv := url.Values{}
+		for key, values := range query {
+			qv[key] = values
+		}
+		qv.Set("page", strconv.Itoa(number))
+		qv.Set("limit", strconv.Itoa(limit))
+		qv.Del("results")
+		u := fmt.Sprintf("%s%s?%s", s.URL, req.URL.Path, qv.Encode())
+		return &u
+	}
+	var previous, next *string
+	if page > 1 {
+		previous = pageURL(page - 1)
+	}
+	if end < len(objs) {
+		next = pageURL(page + 1)
+	}
+
+	writeJSON(rw, http.StatusOK, &struct {
+		Count    int     `json:"count"`
+		Next     *string `json:"next"`
+		Previous *string `json:"previous"`
+		Results  []T     `json:"results"`
+	}{
+		Count:    len(objs),
+		Next:     next,
+		Previous: previous,
+		Results:  objs[start:end],
+	})
+}
+
+// replayed returns the object ID that was created with the
+// Idempotency-Key of req, if any. It must be called with s.mu held.
+func (s *Server) replayed(req *http.Request) (key, objectID string) {
+	key = req.Header.Get("Idempotency-Key")
+	if key == "" {
+		return "", ""
+	}
+	key = req.URL.Path + "/" + key
+	return key, s.idempotent[key]
+}
+
+func (s *Server) remember(key, objectID string) {
+	if key != "" {
+		s.idempotent[key] = objectID
+	}
+}
+
+func (s *Server) createAddress(rw http.ResponseWriter, req *http.Request) {
+	addr := new(goshippo.Address)
+	if err := json.NewDecoder(req.Body).Decode(addr); err != nil {
+		writeDetail(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	if strings.TrimSpace(addr.Country) == "" {
+		writeFieldError(rw, "country", "This field is required.")
+		return
+	}
+
+	key, replayedID := s.replayed(req)
+	if existing, ok := s.addresses.get(replayedID); ok {
+		writeJSON(rw, http.StatusCreated, existing)
+		return
+	}
+	s.storeAddress(addr)
+	if addr.ShouldValidate {
+		validate(addr)
+	}
+	s.remember(key, addr.ID)
+	writeJSON(rw, http.StatusCreated, addr)
+}
+
+// storeAddress fills in the output only fields of addr and
+// stores it. It must be called with s.mu held.
+func (s *Server) storeAddress(addr *goshippo.Address) {
+	addr.ID = s.mintID()
+	addr.CreatedAt = now()
+	addr.UpdatedAt = addr.CreatedAt
+	addr.OwnerUsername = s.owner()
+	addr.InTestMode = true
+	addr.Purpose, addr.ObjectState = "", ""
+	addr.Complete = addr.AddresseeName != "" && addr.Street1 != "" && addr.City != "" && addr.Country != ""
+	s.addresses.put(addr.ID, addr)
+}
+
+// validate marks addresses with a street, a city or
+// ZIP code and a country as valid and the rest as invalid.
+func validate(addr *goshippo.Address) {
+	result := &goshippo.ValidationResult{Valid: true, Messages: []*goshippo.ValidationMessage{}}
+	if addr.Street1 == "" || (addr.City == "" && addr.ZipCode == "") || addr.Country == "" {
+		result.Valid = false
+		result.Messages = append(result.Messages, &goshippo.ValidationMessage{
+			Source: "goshippotest",
+			Code:   "Unknown Street",
+			Text:   "The address could not be found.",
+		})
+	}
+	addr.ValidationResults = result
+	addr.UpdatedAt = now()
+}
+
+func (s *Server) validateAddress(rw http.ResponseWriter, addressID string) {
+	addr, ok := s.addresses.get(addressID)
+	if ok {
+		validate(addr)
+	}
+	writeObject(rw, addr, ok)
+}
+
+func (s *Server) createParcel(rw http.ResponseWriter, req *http.Request) {
+	parcel := new(goshippo.Parcel)
+	if err := json.NewDecoder(req.Body).Decode(parcel); err != nil {
+		writeDetail(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := parcel.Validate(); err != nil {
+		writeDetail(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	key, replayedID := s.replayed(req)
+	if existing, ok := s.parcels.get(replayedID); ok {
+		writeJSON(rw, http.StatusCreated, existing)
+		return
+	}
+	s.storeParcel(parcel)
+	s.remember(key, parcel.ID)
+	writeJSON(rw, http.StatusCreated, parcel)
+}
+
+// storeParcel must be called with s.mu held.
+func (s *Server) storeParcel(parcel *goshippo.Parcel) {
+	parcel.ID = s.mintID()
+	parcel.CreatedAt = now()
+	parcel.UpdatedAt = parcel.CreatedAt
+	parcel.OwnerUsername = s.owner()
+	parcel.InTestMode = true
+	parcel.Purpose = ""
+	parcel.State = "VALID"
+	s.parcels.put(parcel.ID, parcel)
+}
+
+var errRequired = errors.New("This field is required.")
+
+// Shipment is a shipment of parcels between two addresses,
+// which is rated by the carriers upon creation.
+type Shipment struct {
+	ID            string     `json:"object_id"`
+	OwnerUsername string     `json:"object_owner"`
+	CreatedAt     *time.Time `json:"object_created"`
+	UpdatedAt     *time.Time `json:"object_updated"`
+	Status        string     `json:"status"`
+
+	AddressFrom *goshippo.Address  `json:"address_from"`
+	AddressTo   *goshippo.Address  `json:"address_to"`
+	Parcels     []*goshippo.Parcel `json:"parcels"`
+	Rates       []*Rate            `json:"rates"`
+
+	Metadata   string `json:"metadata,omitempty"`
+	InTestMode bool   `json:"test"`
+}
+
+// Rate is the offer of a carrier for a Shipment.
+type Rate struct {
+	ID            string     `json:"object_id"`
+	OwnerUsername string     `json:"object_owner"`
+	CreatedAt     *time.Time `json:"object_created"`
+	Shipment      string     `json:"shipment"`
+
+	Amount        string        `json:"amount"`
+	Currency      string        `json:"currency"`
+	Provider      string        `json:"provider"`
+	ServiceLevel  *ServiceLevel `json:"servicelevel"`
+	EstimatedDays int           `json:"estimated_days"`
+
+	InTestMode bool `json:"test"`
+}
+
+type ServiceLevel struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`
+}
+
+// rateCard holds the rates offered for every shipment.
+var rateCard = [...]Rate{
+	{Provider: "USPS", Amount: "7.58", ServiceLevel: &ServiceLevel{Name: "Priority Mail", Token: "usps_priority"}, EstimatedDays: 2},
+	{Provider: "USPS", Amount: "5.16", ServiceLevel: &ServiceLevel{Name: "Ground Advantage", Token: "usps_ground_advantage"}, EstimatedDays: 5},
+	{Provider: "UPS", Amount: "11.27", ServiceLevel: &ServiceLevel{Name: "Ground", Token: "ups_ground"}, EstimatedDays: 3},
+}
+
+type shipmentRequest struct {
+	AddressFrom json.RawMessage   `json:"address_from"`
+	AddressTo   json.RawMessage   `json:"address_to"`
+	Parcels     []json.RawMessage `json:"parcels"`
+	Metadata    string            `json:"metadata"`
+}
+
+func (s *Server) createShipment(rw http.ResponseWriter, req *http.Request) {
+	sreq := new(shipmentRequest)
+	if err := json.NewDecoder(req.Body).Decode(sreq); err != nil {
+		writeDetail(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	key, replayedID := s.replayed(req)
+	if existing, ok := s.shipments.get(replayedID); ok {
+		writeJSON(rw, http.StatusCreated, existing)
+		return
+	}
+
+	addressFrom, err := s.resolveAddress(sreq.AddressFrom)
+	if err != nil {
+		writeFieldError(rw, "address_from", err.Error())
+		return
+	}
+	addressTo, err := s.resolveAddress(sreq.AddressTo)
+	if err != nil {
+		writeFieldError(rw, "address_to", err.Error())
+		return
+	}
+	if len(sreq.Parcels) == 0 {
+		writeFieldError(rw, "parcels", "This field is required.")
+		return
+	}
+	var parcels []*goshippo.Parcel
+	for _, raw := range sreq.Parcels {
+		parcel, err := s.resolveParcel(raw)
+		if err != nil {
+			writeFieldError(rw, "parcels", err.Error())
+			return
+		}
+		parcels = append(parcels, parcel)
+	}
+
+	shipment := &Shipment{
+		ID:            s.mintID(),
+		OwnerUsername: s.owner(),
+		CreatedAt:     now(),
+		Status:        "SUCCESS",
+		AddressFrom:   addressFrom,
+		AddressTo:     addressTo,
+		Parcels:       parcels,
+		Metadata:      sreq.Metadata,
+		InTestMode:    true,
+	}
+	shipment.UpdatedAt = shipment.CreatedAt
+	for _, card := range rateCard {
+		rate := card
+		rate.ID = s.mintID()
+		rate.OwnerUsername = s.owner()
+		rate.CreatedAt = shipment.CreatedAt
+		rate.Shipment = shipment.ID
+		rate.Currency = "USD"
+		rate.InTestMode = true
+		s.rates.put(rate.ID, &rate)
+		shipment.Rates = append(shipment.Rates, &rate)
+	}
+	s.shipments.put(shipment.ID, shipment)
+	s.remember(key, shipment.ID)
+	writeJSON(rw, http.StatusCreated, shipment)
+}
+
+// resolveAddress looks up raw if it is an ID, otherwise
+// it creates the address in it. It must be called with s.mu held.
+func (s *Server) resolveAddress(raw json.RawMessage) (*goshippo.Address, error) {
+	var addressID string
+	if err := json.Unmarshal(raw, &addressID); err == nil {
+		if addr, ok := s.addresses.get(addressID); ok {
+			return addr, nil
+		}
+		return nil, fmt.Errorf("Address with object_id %q does not exist.", addressID)
+	}
+	addr := new(goshippo.Address)
+	if err := json.Unmarshal(raw, addr); err != nil || addr.Country == "" {
+		return nil, errRequired
+	}
+	s.storeAddress(addr)
+	return addr, nil
+}
+
+// resolveParcel is like resolveAddress, for parcels.
+func (s *Server) resolveParcel(raw json.RawMessage) (*goshippo.Parcel, error) {
+	var parcelID string
+	if err := json.Unmarshal(raw, &parcelID); err == nil {
+		if parcel, ok := s.parcels.get(parcelID); ok {
+			return parcel, nil
+		}
+		return nil, fmt.Errorf("Parcel with object_id %q does not exist.", parcelID)
+	}
+	parcel := new(goshippo.Parcel)
+	if err := json.Unmarshal(raw, parcel); err != nil {
+		return nil, err
+	}
+	if err := parcel.Validate(); err != nil {
+		return nil, err
+	}
+	s.storeParcel(parcel)
+	return parcel, nil
+}
+
+func (s *Server) createTransaction(rw http.ResponseWriter, req *http.Request) {
+	transaction := new(goshippo.Transaction)
+	if err := json.NewDecoder(req.Body).Decode(transaction); err != nil {
+		writeDetail(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	key, replayedID := s.replayed(req)
+	if existing, ok := s.transactions.get(replayedID); ok {
+		writeJSON(rw, http.StatusCreated, existing)
+		return
+	}
+	rate, ok := s.rates.get(transaction.Rate)
+	if !ok {
+		writeFieldError(rw, "rate", fmt.Sprintf("Rate with object_id %q does not exist.", transaction.Rate))
+		return
+	}
+
+	transaction.ID = s.mintID()
+	transaction.OwnerUsername = s.owner()
+	transaction.CreatedAt = now()
+	transaction.UpdatedAt = transaction.CreatedAt
+	transaction.State = "VALID"
+	transaction.Status = goshippo.TransactionSuccess
+	transaction.InTestMode = true
+	if transaction.LabelFileType == goshippo.LabelUndefined {
+		transaction.LabelFileType = goshippo.LabelPDF
+	}
+	transaction.TrackingNumber = fmt.Sprintf("9205590%015d", s.lastID)
+	transaction.LabelURL = fmt.Sprintf("%s/labels/%s.pdf", s.URL, transaction.ID)
+	transaction.TrackingURLProvider = fmt.Sprintf("%s/tracking/%s", s.URL, transaction.TrackingNumber)
+
+	carrier := strings.ToLower(rate.Provider)
+	s.tracks[trackKey(carrier, transaction.TrackingNumber)] = &Track{
+		Carrier:        carrier,
+		TrackingNumber: transaction.TrackingNumber,
+		Transaction:    transaction.ID,
+		Status:         &TrackingStatus{Status: "PRE_TRANSIT", Details: "The label has been created.", Date: *transaction.CreatedAt},
+		InTestMode:     true,
+	}
+	s.transactions.put(transaction.ID, transaction)
+	s.remember(key, transaction.ID)
+	writeJSON(rw, http.StatusCreated, transaction)
+}
+
+// Track is the tracking status of a shipment.
+type Track struct {
+	Carrier        string            `json:"carrier"`
+	TrackingNumber string            `json:"tracking_number"`
+	Transaction    string            `json:"transaction,omitempty"`
+	Status         *TrackingStatus   `json:"tracking_status"`
+	History        []*TrackingStatus `json:"tracking_history"`
+	Metadata       string            `json:"metadata,omitempty"`
+	InTestMode     bool              `json:"test"`
+}
+
+type TrackingStatus struct {
+	// Status is one of "UNKNOWN", "PRE_TRANSIT", "TRANSIT",
+	// "DELIVERED", "RETURNED" or "FAILURE".
+	Status  string    `json:"status"`
+	Details string    `json:"status_details"`
+	Date    time.Time `json:"status_date"`
+}
+
+func trackKey(carrier, trackingNumber string) string {
+	return strings.ToLower(carrier) + "/" + trackingNumber
+}
+
+// track returns the known track, or like GoShippo, synthesizes
+// one for the test tracking numbers of the form SHIPPO_<STATUS>
+// e.g SHIPPO_DELIVERED. It must be called with s.mu held.
+func (s *Server) track(carrier, trackingNumber string) (*Track, bool) {
+	if track, ok := s.tracks[trackKey(carrier, trackingNumber)]; ok {
+		return track, true
+	}
+	status, ok := strings.CutPrefix(trackingNumber, "SHIPPO_")
+	if !ok {
+		return nil, false
+	}
+	tstatus := &TrackingStatus{Status: status, Details: "Test tracking status.", Date: *now()}
+	return &Track{
+		Carrier:        strings.ToLower(carrier),
+		TrackingNumber: trackingNumber,
+		Status:         tstatus,
+		History:        []*TrackingStatus{tstatus},
+		InTestMode:     true,
+	}, true
+}
+
+func (s *Server) registerTrack(rw http.ResponseWriter, req *http.Request) {
+	treq := new(Track)
+	if err := json.NewDecoder(req.Body).Decode(treq); err != nil {
+		writeDetail(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	if treq.Carrier == "" || treq.TrackingNumber == "" {
+		writeFieldError(rw, "tracking_number", "This field is required.")
+		return
+	}
+
+	track, ok := s.track(treq.Carrier, treq.TrackingNumber)
+	if !ok {
+		track = &Track{
+			Carrier:        strings.ToLower(treq.Carrier),
+			TrackingNumber: treq.TrackingNumber,
+			Status:         &TrackingStatus{Status: "UNKNOWN", Date: *now()},
+			InTestMode:     true,
+		}
+	}
+	track.Metadata = treq.Metadata
+	s.tracks[trackKey(track.Carrier, track.TrackingNumber)] = track
+	writeJSON(rw, http.StatusCreated, track)
+}
+
+// SetTrackingStatus moves the track of trackingNumber
+// to status, keeping its previous status in its history.
+func (s *Server) SetTrackingStatus(carrier, trackingNumber, status, details string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := trackKey(carrier, trackingNumber)
+	track, ok := s.tracks[key]
+	if !ok {
+		track = &Track{Carrier: strings.ToLower(carrier), TrackingNumber: trackingNumber, InTestMode: true}
+		s.tracks[key] = track
+	}
+	if track.Status != nil {
+		track.History = append(track.History, track.Status)
+	}
+	track.Status = &TrackingStatus{Status: status, Details: details, Date: *now()}
+}
+
+func (s *Server) createAccount(rw http.ResponseWriter, req *http.Request) {
+	acct := new(goshippo.ManagedAccount)
+	if err := json.NewDecoder(req.Body).Decode(acct); err != nil {
+		writeDetail(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := acct.Validate(); err != nil {
+		writeDetail(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	key, replayedID := s.replayed(req)
+	if existing, ok := s.accounts.get(replayedID); ok {
+		writeJSON(rw, http.StatusCreated, existing)
+		return
+	}
+	acct.ID = s.mintID()
+	acct.CreatedAt = now()
+	acct.UpdatedAt = acct.CreatedAt
+	s.accounts.put(acct.ID, acct)
+	s.remember(key, acct.ID)
+	writeJSON(rw, http.StatusCreated, acct)
+}
+
+func (s *Server) updateAccount(rw http.ResponseWriter, req *http.Request, accountID string) {
+	existing, ok := s.accounts.get(accountID)
+	if !ok {
+		writeDetail(rw, http.StatusNotFound, "Not found.")
+		return
+	}
+	acct := new(goshippo.ManagedAccount)
+	if err := json.NewDecoder(req.Body).Decode(acct); err != nil {
+		writeDetail(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := acct.Validate(); err != nil {
+		writeDetail(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	acct.ID, acct.CreatedAt = existing.ID, existing.CreatedAt
+	acct.UpdatedAt = now()
+	s.accounts.put(acct.ID, acct)
+	writeJSON(rw, http.StatusOK, acct)
+}
+
+// AddAddress stores a copy of addr, as if it had been
+// created through the API, and returns the stored address.
+func (s *Server) AddAddress(addr goshippo.Address) *goshippo.Address {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.storeAddress(&addr)
+	return &addr
+}
+
+// AddParcel is like AddAddress, for parcels.
+func (s *Server) AddParcel(parcel goshippo.Parcel) *goshippo.Parcel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.storeParcel(&parcel)
+	return &parcel
+}
+
+// Addresses returns the stored addresses, from the newest.
+// They must not be modified.
+func (s *Server) Addresses() []*goshippo.Address {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addresses.newestFirst()
+}
+
+// ManagedAccounts returns the stored managed accounts,
+// from the newest. They must not be modified.
+func (s *Server) ManagedAccounts() []*goshippo.ManagedAccount {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.accounts.newestFirst()
+}
+
+// Transactions returns the stored transactions, from the newest.
+// They must not be modified.
+func (s *Server) Transactions() []*goshippo.Transaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.transactions.newestFirst()
+}
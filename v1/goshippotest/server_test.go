@@ -0,0 +1,376 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippotest_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/orijtech/goshippo/v1"
+	"github.com/orijtech/goshippo/v1/goshippotest"
+)
+
+func TestAddressesAndPagination(t *testing.T) {
+	srv := goshippotest.NewServer()
+	defer srv.Close()
+	srv.SetPageSize(5)
+
+	client, err := srv.Client()
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+
+	var created []*goshippo.Address
+	for i := 0; i < 12; i++ {
+		addr, err := client.CreateAddress(&goshippo.Address{
+			Purpose:       "PURCHASE",
+			AddresseeName: fmt.Sprintf("Bot %d", i),
+			Street1:       "215 Clayton St.",
+			City:          "San Francisco",
+			Country:       "US",
+		})
+		if err != nil {
+			t.Fatalf("#%d: createAddress err: %v", i, err)
+		}
+		if addr.ID == "" || addr.CreatedAt == nil || !addr.InTestMode {
+			t.Errorf("#%d: missing output only fields: %+v", i, addr)
+		}
+		created = append(created, addr)
+	}
+
+	got, err := client.AddressByID(created[3].ID)
+	if err != nil {
+		t.Fatalf("addressByID err: %v", err)
+	}
+	if got.AddresseeName != "Bot 3" {
+		t.Errorf("gotName=%q wantName=%q", got.AddresseeName, "Bot 3")
+	}
+
+	pager, err := client.NewAddressPager(&goshippo.AddressListRequest{ThrottleDurationMs: goshippo.NoThrottle})
+	if err != nil {
+		t.Fatalf("newPager err: %v", err)
+	}
+	var pages int
+	var ids []string
+	for page, err := range pager.Pages(context.Background()) {
+		if err != nil {
+			t.Fatalf("page err: %v", err)
+		}
+		pages += 1
+		for _, addr := range page.Items {
+			ids = append(ids, addr.ID)
+		}
+	}
+	if pages != 3 || len(ids) != 12 || pager.Count() != 12 {
+		t.Errorf("gotPages=%d gotAddresses=%d gotCount=%d want 3, 12 and 12", pages, len(ids), pager.Count())
+	}
+	if len(ids) > 0 && ids[0] != created[11].ID {
+		t.Errorf("expecting the newest address first, got %q", ids[0])
+	}
+}
+
+func TestPurchaseAndTracking(t *testing.T) {
+	srv := goshippotest.NewServer()
+	defer srv.Close()
+
+	client, err := srv.Client()
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+
+	shipment := createShipment(t, srv)
+	if len(shipment.Rates) == 0 {
+		t.Fatal("expecting the shipment to be rated")
+	}
+
+	if _, err := client.CreateTransaction(&goshippo.Transaction{Rate: "no-such-rate"}); err == nil {
+		t.Error("expecting an error for an unknown rate")
+	} else if apiErr := new(goshippo.APIError); !errors.As(err, &apiErr) || !apiErr.IsValidation() {
+		t.Errorf("expecting a validation error, got %v", err)
+	}
+
+	tx, err := client.CreateTransaction(&goshippo.Transaction{Rate: shipment.Rates[0].ID})
+	if err != nil {
+		t.Fatalf("createTransaction err: %v", err)
+	}
+	if tx.Status != goshippo.TransactionSuccess || tx.TrackingNumber == "" || tx.LabelURL == "" {
+		t.Errorf("unexpected transaction: %+v", tx)
+	}
+
+	carrier := "usps"
+	if track := getTrack(t, srv, carrier, tx.TrackingNumber); track.Status.Status != "PRE_TRANSIT" {
+		t.Errorf("gotStatus=%q wantStatus=PRE_TRANSIT", track.Status.Status)
+	}
+	srv.SetTrackingStatus(carrier, tx.TrackingNumber, "DELIVERED", "Left at the front door.")
+	track := getTrack(t, srv, carrier, tx.TrackingNumber)
+	if track.Status.Status != "DELIVERED" || len(track.History) != 1 {
+		t.Errorf("gotStatus=%q gotHistory=%d want DELIVERED and 1", track.Status.Status, len(track.History))
+	}
+	if track := getTrack(t, srv, "ups", "SHIPPO_TRANSIT"); track.Status.Status != "TRANSIT" {
+		t.Errorf("gotStatus=%q wantStatus=TRANSIT", track.Status.Status)
+	}
+}
+
+func TestInjectedFailures(t *testing.T) {
+	srv := goshippotest.NewServer()
+	defer srv.Close()
+
+	parcel := &goshippo.Parcel{
+		Length: 5, Width: 5, Height: 5, Weight: 2,
+		DistanceUnit: goshippo.DistanceInch, MassUnit: goshippo.MassPound,
+	}
+
+	tests := [...]struct {
+		failure     goshippotest.Failure
+		retry       bool
+		wantErr     bool
+		wantParcels int
+	}{
+		0: {failure: goshippotest.Failure{Method: "POST", PathPrefix: "/parcels/", StatusCode: http.StatusServiceUnavailable}, wantErr: true},
+		1: {failure: goshippotest.Failure{Method: "POST", PathPrefix: "/parcels/", StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"0"}}}, retry: true, wantParcels: 1},
+		2: {failure: goshippotest.Failure{PathPrefix: "/addresses/", StatusCode: http.StatusServiceUnavailable}, wantParcels: 1},
+		3: {failure: goshippotest.Failure{Method: "POST", DropConnection: true, Times: -1}, retry: true, wantErr: true},
+	}
+
+	for i, tt := range tests {
+		srv.ClearFailures()
+		srv.InjectFailure(tt.failure)
+
+		var opts []goshippo.Option
+		if tt.retry {
+			policy := goshippo.DefaultRetryPolicy()
+			policy.InitialBackoff = time.Millisecond
+			policy.MaxBackoff = time.Millisecond
+			opts = append(opts, goshippo.WithRetryPolicy(policy))
+		}
+		client, err := srv.Client(opts...)
+		if err != nil {
+			t.Fatalf("#%d: client err: %v", i, err)
+		}
+
+		pager, err := client.NewParcelPager(nil)
+		if err != nil {
+			t.Fatalf("#%d: newPager err: %v", i, err)
+		}
+		before := countParcels(t, pager)
+
+		_, err = client.CreateParcel(parcel)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("#%d: expected a non-nil error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: gotErr=%v", i, err)
+			continue
+		}
+
+		pager, err = client.NewParcelPager(nil)
+		if err != nil {
+			t.Fatalf("#%d: newPager err: %v", i, err)
+		}
+		if got := countParcels(t, pager) - before; got != tt.wantParcels {
+			t.Errorf("#%d: gotNewParcels=%d wantNewParcels=%d", i, got, tt.wantParcels)
+		}
+	}
+}
+
+func TestRejectsMissingAuth(t *testing.T) {
+	srv := goshippotest.NewServer()
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/addresses/")
+	if err != nil {
+		t.Fatalf("get err: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("gotStatusCode=%d wantStatusCode=%d", res.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+func countParcels(t *testing.T, pager *goshippo.Pager[*goshippo.Parcel]) int {
+	var n int
+	for _, err := range pager.All(context.Background()) {
+		if err != nil {
+			t.Fatalf("listParcels err: %v", err)
+		}
+		n += 1
+	}
+	return n
+}
+
+func doJSON(t *testing.T, method, url string, in, out interface{}) {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			t.Fatalf("encode err: %v", err)
+		}
+	}
+	req, err := http.NewRequest(method, url, &body)
+	if err != nil {
+		t.Fatalf("request err: %v", err)
+	}
+	req.Header.Set("Authorization", "ShippoToken "+goshippotest.TestToken)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s err: %v", method, url, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		t.Fatalf("%s %s: status %s", method, url, res.Status)
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		t.Fatalf("decode err: %v", err)
+	}
+}
+
+func createShipment(t *testing.T, srv *goshippotest.Server) *goshippotest.Shipment {
+	addr := srv.AddAddress(goshippo.Address{AddresseeName: "Orijtech", Street1: "215 Clayton St.", City: "San Francisco", Country: "US"})
+	shipment := new(goshippotest.Shipment)
+	doJSON(t, "POST", srv.URL+"/shipments/", map[string]interface{}{
+		"address_from": addr.ID,
+		"address_to":   map[string]string{"name": "Shippo", "street1": "731 Market St", "city": "San Francisco", "country": "US"},
+		"parcels": []map[string]string{
+			{"length": "5", "width": "5", "height": "5", "distance_unit": "in", "weight": "2", "mass_unit": "lb"},
+		},
+	}, shipment)
+	return shipment
+}
+
+func getTrack(t *testing.T, srv *goshippotest.Server, carrier, trackingNumber string) *goshippotest.Track {
+	track := new(goshippotest.Track)
+	doJSON(t, "GET", fmt.Sprintf("%s/tracks/%s/%s/", srv.URL, carrier, trackingNumber), nil, track)
+	return track
+}
+
+func TestManagedAccounts(t *testing.T) {
+	srv := goshippotest.NewServer()
+	defer srv.Close()
+	srv.SetPageSize(2)
+
+	client, err := srv.Client()
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+
+	var accounts []*goshippo.ManagedAccount
+	for i := 0; i < 3; i++ {
+		acct, err := client.CreateManagedAccount(&goshippo.ManagedAccount{
+			Email:       fmt.Sprintf("merchant%d@example.org", i),
+			FirstName:   "Merchant",
+			LastName:    fmt.Sprintf("#%d", i),
+			CompanyName: "Acme",
+		})
+		if err != nil {
+			t.Fatalf("#%d: createManagedAccount err: %v", i, err)
+		}
+		accounts = append(accounts, acct)
+	}
+
+	updated := *accounts[1]
+	updated.CompanyName = "Acme Inc"
+	if _, err := client.UpdateManagedAccount(&updated); err != nil {
+		t.Fatalf("updateManagedAccount err: %v", err)
+	}
+	got, err := client.ManagedAccountByID(updated.ID)
+	if err != nil {
+		t.Fatalf("managedAccountByID err: %v", err)
+	}
+	if got.CompanyName != "Acme Inc" {
+		t.Errorf("gotCompanyName=%q wantCompanyName=%q", got.CompanyName, "Acme Inc")
+	}
+
+	pager, err := client.NewManagedAccountPager(&goshippo.ListRequest{ThrottleDurationMs: goshippo.NoThrottle})
+	if err != nil {
+		t.Fatalf("newPager err: %v", err)
+	}
+	var listed int
+	for _, err := range pager.All(context.Background()) {
+		if err != nil {
+			t.Fatalf("listManagedAccounts err: %v", err)
+		}
+		listed += 1
+	}
+	if listed != 3 {
+		t.Errorf("gotAccounts=%d wantAccounts=3", listed)
+	}
+
+	// Objects created while acting as a managed account are its own.
+	ctx := goshippo.WithManagedAccount(context.Background(), accounts[2].ID)
+	addr, err := client.CreateAddressContext(ctx, &goshippo.Address{Purpose: "PURCHASE", Street1: "215 Clayton St.", City: "San Francisco", Country: "US"})
+	if err != nil {
+		t.Fatalf("createAddress err: %v", err)
+	}
+	if addr.OwnerUsername != accounts[2].Email {
+		t.Errorf("gotOwner=%q wantOwner=%q", addr.OwnerUsername, accounts[2].Email)
+	}
+
+	ctx = goshippo.WithManagedAccount(context.Background(), "no-such-account")
+	if _, err := client.CreateAddressContext(ctx, &goshippo.Address{Purpose: "PURCHASE", Country: "US"}); err == nil {
+		t.Error("expected an error for an unknown managed account")
+	}
+}
+
+func TestOAuthFlow(t *testing.T) {
+	srv := goshippotest.NewServer()
+	defer srv.Close()
+
+	oc := srv.OAuthConfig()
+	authURL, state, err := oc.AuthCodeURL()
+	if err != nil {
+		t.Fatalf("authCodeURL err: %v", err)
+	}
+	query, err := srv.Authorize(authURL)
+	if err != nil {
+		t.Fatalf("authorize err: %v", err)
+	}
+
+	callback, err := http.NewRequest("GET", "https://app.example.org/callback?"+query, nil)
+	if err != nil {
+		t.Fatalf("request err: %v", err)
+	}
+	tok, err := oc.ExchangeCallback(context.Background(), callback, state)
+	if err != nil {
+		t.Fatalf("exchangeCallback err: %v", err)
+	}
+	// Codes can only be exchanged once.
+	if _, err := oc.ExchangeCallback(context.Background(), callback, state); err == nil {
+		t.Error("expected an error when reusing a code")
+	}
+
+	client, err := oc.Client(tok, goshippo.WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	if _, err := client.CreateAddress(&goshippo.Address{Purpose: "PURCHASE", Country: "US"}); err != nil {
+		t.Errorf("createAddress err: %v", err)
+	}
+
+	forged, err := oc.Client(&goshippo.OAuthToken{AccessToken: "oauth.forged"}, goshippo.WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	if _, err := forged.CreateAddress(&goshippo.Address{Purpose: "PURCHASE", Country: "US"}); err == nil {
+		t.Error("expected an error for an access token that wasn't issued")
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// Journal maps idempotency keys to the IDs of the objects that were
+// created with them, so that replaying a create call, for example
+// after a crash or a timeout, returns the original object instead
+// of creating a duplicate. Implementations must be safe for
+// concurrent use.
+type Journal interface {
+	// Lookup returns the ID of the object created
+	// with key and true, if key was recorded.
+	Lookup(key string) (objectID string, ok bool, err error)
+
+	// Record saves the ID of the object created with key.
+	Record(key, objectID string) error
+}
+
+type idempotencyKeyCtxKey struct{}
+
+// WithIdempotencyKey returns a context that makes the object creating
+// ...Context methods, such as CreateParcelContext, use key. Keys should
+// be derived from the caller's own records e.g an order ID, so that a
+// replayed call uses the same key as the original one. Calls without
+// a key are sent with a fresh random key and are never deduplicated.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtxKey{}, strings.TrimSpace(key))
+}
+
+// callerIdempotencyKey returns the key that the
+// caller set with WithIdempotencyKey, if any.
+func callerIdempotencyKey(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyCtxKey{}).(string)
+	return key
+}
+
+// idempotencyKey returns the key for a mutating request and
+// whether it came from the caller and can hence be replayed.
+func idempotencyKey(ctx context.Context) (string, bool, error) {
+	if key := callerIdempotencyKey(ctx); key != "" {
+		return key, true, nil
+	}
+	key, err := randomKey()
+	return key, false, err
+}
+
+func randomKey() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func (c *Client) SetJournal(j Journal) {
+	c.mu.Lock()
+	c.journal = j
+	c.mu.Unlock()
+}
+
+func (c *Client) currentJournal() Journal {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.journal
+}
+
+// journalKey is the key that the object created with key is journaled
+// under. It is scoped to the tenant of ctx, if any, so that tenants that
+// happen to use the same keys never get each other's objects back.
+func journalKey(ctx context.Context, class EndpointClass, key string) string {
+	if scope := tenantScope(ctx); scope != "" {
+		return "tenant/" + scope + "/" + string(class) + "/" + key
+	}
+	return string(class) + "/" + key
+}
+
+// replayedID returns the ID of the object that was previously
+// created for the idempotency key in ctx, if there is one.
+func (c *Client) replayedID(ctx context.Context, class EndpointClass) (key, objectID string, err error) {
+	key, replayable, err := idempotencyKey(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	j := c.currentJournal()
+	if !replayable || j == nil {
+		return key, "", nil
+	}
+	objectID, ok, err := j.Lookup(journalKey(ctx, class, key))
+	if err != nil || !ok {
+		return key, "", err
+	}
+	return key, objectID, nil
+}
+
+// recordCreated saves objectID in the journal if key was
+// passed in by the caller, otherwise it can never be replayed.
+func (c *Client) recordCreated(ctx context.Context, class EndpointClass, key, objectID string) error {
+	j := c.currentJournal()
+	if j == nil || objectID == "" {
+		return nil
+	}
+	if key == "" || key != callerIdempotencyKey(ctx) {
+		return nil
+	}
+	return j.Record(journalKey(ctx, class, key), objectID)
+}
+
+type MemoryJournal struct {
+	mu      sync.RWMutex
+	entries map[string]string
+}
+
+var _ Journal = (*MemoryJournal)(nil)
+
+func NewMemoryJournal() *MemoryJournal {
+	return &MemoryJournal{entries: make(map[string]string)}
+}
+
+func (mj *MemoryJournal) Lookup(key string) (string, bool, error) {
+	mj.mu.RLock()
+	defer mj.mu.RUnlock()
+
+	objectID, ok := mj.entries[key]
+	return objectID, ok, nil
+}
+
+func (mj *MemoryJournal) Record(key, objectID string) error {
+	mj.mu.Lock()
+	defer mj.mu.Unlock()
+
+	mj.entries[key] = objectID
+	return nil
+}
+
+// FileJournal is a Journal that persists its entries as
+// JSON lines, appended to a file and synced on every Record.
+type FileJournal struct {
+	mu      sync.Mutex
+	f       *os.File
+	entries map[string]string
+}
+
+var _ Journal = (*FileJournal)(nil)
+
+type journalEntry struct {
+	Key       string    `json:"key"`
+	ObjectID  string    `json:"object_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+var errClosedJournal = errors.New("journal is closed")
+
+// NewFileJournal opens, or creates, the journal at path
+// and loads the entries that were previously recorded.
+func NewFileJournal(path string) (*FileJournal, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]string)
+	// complete is the length of the lines that were fully written.
+	var complete int64
+	br := bufio.NewReader(f)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			f.Close()
+			return nil, err
+		}
+		entry := new(journalEntry)
+		parsed := json.Unmarshal(line, entry) == nil
+		if parsed {
+			entries[entry.Key] = entry.ObjectID
+		}
+		if err == nil {
+			complete += int64(len(line))
+			continue
+		}
+		if len(line) == 0 {
+			break
+		}
+		// The last line was partially written when the process
+		// crashed. Finish it, or cut it off if it can't be parsed,
+		// so that the entries recorded next start on a line of
+		// their own and can be read back.
+		if parsed {
+			_, err = f.Write([]byte{'\n'})
+		} else {
+			err = f.Truncate(complete)
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		break
+	}
+	return &FileJournal{f: f, entries: entries}, nil
+}
+
+func (fj *FileJournal) Lookup(key string) (string, bool, error) {
+	fj.mu.Lock()
+	defer fj.mu.Unlock()
+
+	if fj.f == nil {
+		return "", false, errClosedJournal
+	}
+	objectID, ok := fj.entries[key]
+	return objectID, ok, nil
+}
+
+func (fj *FileJournal) Record(key, objectID string) error {
+	fj.mu.Lock()
+	defer fj.mu.Unlock()
+
+	if fj.f == nil {
+		return errClosedJournal
+	}
+	blob, err := json.Marshal(&journalEntry{Key: key, ObjectID: objectID, CreatedAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	if _, err := fj.f.Write(append(blob, '\n')); err != nil {
+		return err
+	}
+	if err := fj.f.Sync(); err != nil {
+		return err
+	}
+	fj.entries[key] = objectID
+	return nil
+}
+
+func (fj *FileJournal) Close() error {
+	fj.mu.Lock()
+	defer fj.mu.Unlock()
+
+	if fj.f == nil {
+		return errClosedJournal
+	}
+	err := fj.f.Close()
+	fj.f = nil
+	return err
+}
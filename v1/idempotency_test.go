@@ -0,0 +1,159 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/orijtech/goshippo/v1"
+)
+
+const parcelID1 = "7df2ecf8b4224763ab7c71fae7ec8274"
+
+func TestIdempotentCreateParcel(t *testing.T) {
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	var posts, gets int
+	var gotKeys []string
+	be := &backend{route: createParcelRoute}
+	rt := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		switch req.Method {
+		case "POST":
+			posts += 1
+			gotKeys = append(gotKeys, req.Header.Get("Idempotency-Key"))
+			return be.RoundTrip(req)
+		default:
+			gets += 1
+			if req.URL.Path != "/parcels/"+parcelID1+"/" {
+				return makeResp("unknown parcel", http.StatusNotFound), nil
+			}
+			return respFromFile("./testdata/parcel-1.json")
+		}
+	})
+
+	parcel := &goshippo.Parcel{
+		Length: 5, Width: 5, Height: 5, Weight: 2,
+		DistanceUnit: goshippo.DistanceCentimetre,
+		MassUnit:     goshippo.MassPound,
+	}
+
+	for i := 0; i < 3; i++ {
+		// Reopen the journal every time to simulate process restarts.
+		journal, err := goshippo.NewFileJournal(journalPath)
+		if err != nil {
+			t.Fatalf("#%d: journal err: %v", i, err)
+		}
+		client, err := goshippo.New(goshippo.WithAPIKey(token1), goshippo.WithHTTPRoundTripper(rt), goshippo.WithJournal(journal))
+		if err != nil {
+			t.Fatalf("#%d: client err: %v", i, err)
+		}
+
+		ctx := goshippo.WithIdempotencyKey(context.Background(), "order-1234")
+		got, err := client.CreateParcelContext(ctx, parcel)
+		if err != nil {
+			t.Fatalf("#%d: createParcel err: %v", i, err)
+		}
+		if got.ID != parcelID1 {
+			t.Errorf("#%d: gotID=%q wantID=%q", i, got.ID, parcelID1)
+		}
+		if err := journal.Close(); err != nil {
+			t.Errorf("#%d: close err: %v", i, err)
+		}
+	}
+
+	if posts != 1 || gets != 2 {
+		t.Errorf("gotPosts=%d gotGets=%d wantPosts=1 wantGets=2", posts, gets)
+	}
+	if len(gotKeys) != 1 || gotKeys[0] != "order-1234" {
+		t.Errorf("gotKeys=%q want the caller's key", gotKeys)
+	}
+
+	// Without a caller supplied key, every call creates an object
+	// and is sent with a unique key.
+	client, err := goshippo.New(goshippo.WithAPIKey(token1), goshippo.WithHTTPRoundTripper(rt), goshippo.WithJournal(goshippo.NewMemoryJournal()))
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := client.CreateParcel(parcel); err != nil {
+			t.Fatalf("#%d: createParcel err: %v", i, err)
+		}
+	}
+	if posts != 3 {
+		t.Errorf("gotPosts=%d wantPosts=3", posts)
+	}
+	if n := len(gotKeys); n != 3 || gotKeys[1] == "" || gotKeys[1] == gotKeys[2] {
+		t.Errorf("expecting unique generated keys, got %q", gotKeys)
+	}
+}
+
+func TestFileJournalRecoversFromTornLines(t *testing.T) {
+	tests := [...]struct {
+		torn     string
+		wantKeys []string
+		lostKeys []string
+	}{
+		0: {torn: `{"key":"b","obj`, wantKeys: []string{"a", "c"}, lostKeys: []string{"b"}},
+		// The crash came just before the newline.
+		1: {torn: `{"key":"b","object_id":"obj-b"}`, wantKeys: []string{"a", "b", "c"}},
+		2: {torn: "", wantKeys: []string{"a", "c"}},
+	}
+
+	for i, tt := range tests {
+		journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+		journal, err := goshippo.NewFileJournal(journalPath)
+		if err != nil {
+			t.Fatalf("#%d: newFileJournal err: %v", i, err)
+		}
+		if err := journal.Record("a", "obj-a"); err != nil {
+			t.Fatalf("#%d: record err: %v", i, err)
+		}
+		journal.Close()
+
+		f, err := os.OpenFile(journalPath, os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			t.Fatalf("#%d: open err: %v", i, err)
+		}
+		f.WriteString(tt.torn)
+		f.Close()
+
+		if journal, err = goshippo.NewFileJournal(journalPath); err != nil {
+			t.Fatalf("#%d: reopen err: %v", i, err)
+		}
+		if err := journal.Record("c", "obj-c"); err != nil {
+			t.Fatalf("#%d: record err: %v", i, err)
+		}
+		journal.Close()
+
+		if journal, err = goshippo.NewFileJournal(journalPath); err != nil {
+			t.Fatalf("#%d: reopen err: %v", i, err)
+		}
+		for _, key := range tt.wantKeys {
+			if objectID, ok, err := journal.Lookup(key); err != nil || !ok || objectID != "obj-"+key {
+				t.Errorf("#%d: lookup(%q)=(%q, %v, %v) want (%q, true, nil)", i, key, objectID, ok, err, "obj-"+key)
+			}
+		}
+		for _, key := range tt.lostKeys {
+			if _, ok, _ := journal.Lookup(key); ok {
+				t.Errorf("#%d: torn entry %q was loaded", i, key)
+			}
+		}
+		journal.Close()
+	}
+}
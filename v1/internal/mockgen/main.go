@@ -0,0 +1,216 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command mockgen generates package goshippomock from the
+// interfaces that are declared in the api.go file of goshippo.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"strings"
+)
+
+const header = `// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Code generated by mockgen from api.go. DO NOT EDIT.
+
+package goshippomock
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/orijtech/goshippo/v1"
+)
+
+var _ = context.Background
+
+`
+
+type method struct {
+	name    string
+	params  []string
+	results []string
+}
+
+func main() {
+	src := flag.String("src", "../api.go", "the file that declares the interfaces")
+	out := flag.String("out", "mock.go", "the file to generate")
+	iface := flag.String("interface", "Service", "the interface that the mock implements")
+	flag.Parse()
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, *src, nil, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	interfaces := make(map[string]*ast.InterfaceType)
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if it, ok := ts.Type.(*ast.InterfaceType); ok {
+				interfaces[ts.Name.Name] = it
+			}
+		}
+	}
+
+	methods, err := collect(fset, interfaces, *iface)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	generate(&buf, *iface, methods)
+	blob, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatalf("formatting the generated code: %v\n%s", err, buf.Bytes())
+	}
+	if err := os.WriteFile(*out, blob, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// collect returns the methods of the interface name,
+// including those of the interfaces that it embeds.
+func collect(fset *token.FileSet, interfaces map[string]*ast.InterfaceType, name string) ([]*method, error) {
+	it, ok := interfaces[name]
+	if !ok {
+		return nil, fmt.Errorf("no interface %q", name)
+	}
+	var methods []*method
+	for _, field := range it.Methods.List {
+		switch ft := field.Type.(type) {
+		case *ast.Ident:
+			embedded, err := collect(fset, interfaces, ft.Name)
+			if err != nil {
+				return nil, err
+			}
+			methods = append(methods, embedded...)
+		case *ast.FuncType:
+			m := &method{name: field.Names[0].Name}
+			for _, param := range ft.Params.List {
+				typ := qualify(fset, param.Type)
+				for range param.Names {
+					m.params = append(m.params, typ)
+				}
+				if len(param.Names) == 0 {
+					m.params = append(m.params, typ)
+				}
+			}
+			if ft.Results != nil {
+				for _, result := range ft.Results.List {
+					typ := qualify(fset, result.Type)
+					n := len(result.Names)
+					if n == 0 {
+						n = 1
+					}
+					for i := 0; i < n; i++ {
+						m.results = append(m.results, typ)
+					}
+				}
+			}
+			methods = append(methods, m)
+		}
+	}
+	return methods, nil
+}
+
+var predeclared = map[string]bool{
+	"bool": true, "byte": true, "error": true, "int": true, "int64": true,
+	"interface": true, "rune": true, "string": true, "uint64": true, "any": true,
+}
+
+// qualify returns the source of expr with the identifiers
+// of package goshippo qualified by the package name.
+func qualify(fset *token.FileSet, expr ast.Expr) string {
+	qualified := ast.Expr(expr)
+	ast.Inspect(qualified, func(n ast.Node) bool {
+		switch nt := n.(type) {
+		case *ast.SelectorExpr:
+			// Already qualified e.g context.Context.
+			return false
+		case *ast.Ident:
+			if !predeclared[nt.Name] && ast.IsExported(nt.Name) {
+				nt.Name = "goshippo." + nt.Name
+			}
+		}
+		return true
+	})
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, qualified); err != nil {
+		log.Fatal(err)
+	}
+	return buf.String()
+}
+
+func generate(buf *bytes.Buffer, iface string, methods []*method) {
+	fmt.Fprintf(buf, "// Client is a mock of goshippo.%s. The calls to a method\n", iface)
+	fmt.Fprintf(buf, "// are answered by the func field of the same name with a Func\n")
+	fmt.Fprintf(buf, "// suffix, or fail with ErrNotConfigured if that field is nil.\n")
+	fmt.Fprintf(buf, "type Client struct {\n\trecorder\n\n")
+	for _, m := range methods {
+		fmt.Fprintf(buf, "\t%sFunc func(%s) (%s)\n", m.name, strings.Join(m.params, ", "), strings.Join(m.results, ", "))
+	}
+	fmt.Fprintf(buf, "}\n\nvar _ goshippo.%s = (*Client)(nil)\n", iface)
+
+	for _, m := range methods {
+		var params, args, results []string
+		for i, typ := range m.params {
+			params = append(params, fmt.Sprintf("a%d %s", i, typ))
+			args = append(args, fmt.Sprintf("a%d", i))
+		}
+		for i, typ := range m.results {
+			results = append(results, fmt.Sprintf("r%d %s", i, typ))
+		}
+
+		fmt.Fprintf(buf, "\nfunc (m *Client) %s(%s) (%s) {\n", m.name, strings.Join(params, ", "), strings.Join(results, ", "))
+		fmt.Fprintf(buf, "\tm.record(%q, %s)\n", m.name, strings.Join(append([]string{"[]interface{}{"}, strings.Join(args, ", ")+"}"), ""))
+		fmt.Fprintf(buf, "\tif m.%sFunc == nil {\n", m.name)
+		if n := len(m.results); n > 0 && m.results[n-1] == "error" {
+			fmt.Fprintf(buf, "\t\tr%d = fmt.Errorf(\"%%w: %s\", ErrNotConfigured)\n", n-1, m.name)
+		}
+		fmt.Fprintf(buf, "\t\treturn\n\t}\n")
+		if len(m.results) > 0 {
+			fmt.Fprintf(buf, "\treturn m.%sFunc(%s)\n}\n", m.name, strings.Join(args, ", "))
+		} else {
+			fmt.Fprintf(buf, "\tm.%sFunc(%s)\n\treturn\n}\n", m.name, strings.Join(args, ", "))
+		}
+	}
+}
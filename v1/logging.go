@@ -0,0 +1,238 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LogLevel controls how much of every request and
+// response the Client writes to its Logger.
+type LogLevel int
+
+const (
+	// LogOff disables request and response logging.
+	LogOff LogLevel = iota
+
+	// LogRequests logs the method, URL, status
+	// and duration of every request.
+	LogRequests
+
+	// LogHeaders additionally logs the request and response
+	// headers. Credentials are always redacted.
+	LogHeaders
+
+	// LogBodies additionally logs the request and response
+	// bodies. PII is masked unless SetLogPII(true) was invoked.
+	LogBodies
+)
+
+const redacted = "[REDACTED]"
+
+var (
+	// sensitiveHeaders are always redacted, regardless of the LogLevel.
+	sensitiveHeaders = map[string]bool{
+		"Authorization":       true,
+		"Proxy-Authorization": true,
+		"Cookie":              true,
+		"Set-Cookie":          true,
+	}
+
+	// piiKeys are the JSON keys, of Addresses, ManagedAccounts and
+	// objects that embed them, whose values are masked in logged bodies.
+	piiKeys = map[string]bool{
+		"name":         true,
+		"first_name":   true,
+		"last_name":    true,
+		"company":      true,
+		"company_name": true,
+		"phone":        true,
+		"email":        true,
+		"street1":      true,
+		"street2":      true,
+		"street3":      true,
+		"street_no":    true,
+	}
+)
+
+func (c *Client) SetLogger(logger Logger) {
+	c.mu.Lock()
+	c.logger = logger
+	c.mu.Unlock()
+}
+
+func (c *Client) SetLogLevel(level LogLevel) {
+	c.mu.Lock()
+	c.logLevel = level
+	c.mu.Unlock()
+}
+
+// SetLogPII if set to true stops masking the names, phone numbers,
+// emails and street lines of addresses in logged bodies. Only use
+// it when the logs are guaranteed to be handled as PII.
+func (c *Client) SetLogPII(logPII bool) {
+	c.mu.Lock()
+	c.logPII = logPII
+	c.mu.Unlock()
+}
+
+func (c *Client) logSettings() (Logger, LogLevel, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.logger == nil {
+		return nil, LogOff, false
+	}
+	return c.logger, c.logLevel, c.logPII
+}
+
+// logExchange logs req and the response, or err, that it got
+// back, at the Client's LogLevel. reqBody and resBody are only
+// used for LogBodies.
+func (c *Client) logExchange(req *http.Request, reqBody []byte, res *http.Response, resBody []byte, took time.Duration, err error) {
+	logger, level, logPII := c.logSettings()
+	if logger == nil || level <= LogOff {
+		return
+	}
+
+	tenant := tenantLogSuffix(req.Context())
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "goshippo: --> %s %s%s", req.Method, req.URL, tenant)
+	if level >= LogHeaders {
+		writeHeaders(buf, req.Header)
+	}
+	if level >= LogBodies && len(reqBody) > 0 {
+		fmt.Fprintf(buf, "\n%s", maskBody(reqBody, logPII))
+	}
+
+	switch {
+	case err != nil:
+		fmt.Fprintf(buf, "\ngoshippo: <-- %s %s%s (%s) error: %v", req.Method, req.URL, tenant, took, err)
+	case res != nil:
+		fmt.Fprintf(buf, "\ngoshippo: <-- %s %s %s%s (%s)", res.Status, req.Method, req.URL, tenant, took)
+		if level >= LogHeaders {
+			writeHeaders(buf, res.Header)
+		}
+		if level >= LogBodies && len(resBody) > 0 {
+			fmt.Fprintf(buf, "\n%s", maskBody(resBody, logPII))
+		}
+	}
+	logger.Printf("%s", buf.String())
+}
+
+// tenantLogSuffix returns the tag that log lines
+// about requests made with ctx have for their tenant.
+func tenantLogSuffix(ctx context.Context) string {
+	if id := tenantID(ctx); id != "" {
+		return fmt.Sprintf(" tenant=%q", id)
+	}
+	return ""
+}
+
+// requestBodyForLog returns a copy of req's body if it will be logged.
+func (c *Client) requestBodyForLog(req *http.Request) []byte {
+	_, level, _ := c.logSettings()
+	if level < LogBodies || req.GetBody == nil {
+		return nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil
+	}
+	defer body.Close()
+
+	blob, _ := ioutil.ReadAll(body)
+	return blob
+}
+
+func writeHeaders(buf *bytes.Buffer, hdr http.Header) {
+	redactedHdr := redactHeaders(hdr)
+	keys := make([]string, 0, len(redactedHdr))
+	for key := range redactedHdr {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(buf, "\n\t%s: %s", key, strings.Join(redactedHdr[key], ", "))
+	}
+}
+
+// redactHeaders returns a copy of hdr with credentials redacted.
+// For Authorization headers the scheme e.g "ShippoToken" is kept.
+func redactHeaders(hdr http.Header) http.Header {
+	clone := hdr.Clone()
+	for key, values := range clone {
+		if !sensitiveHeaders[http.CanonicalHeaderKey(key)] {
+			continue
+		}
+		for i, value := range values {
+			if scheme, _, ok := strings.Cut(value, " "); ok && !strings.Contains(key, "Cookie") {
+				values[i] = scheme + " " + redacted
+			} else {
+				values[i] = redacted
+			}
+		}
+	}
+	return clone
+}
+
+// maskBody returns body with the values of PII keys masked, unless
+// logPII is set. Bodies that aren't JSON are elided when masking
+// since there is no telling where the PII could be.
+func maskBody(body []byte, logPII bool) string {
+	if logPII {
+		return string(body)
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return fmt.Sprintf("<%d bytes of non-JSON body elided>", len(body))
+	}
+	blob, err := json.Marshal(maskKeys(v, piiKeys))
+	if err != nil {
+		return fmt.Sprintf("<%d bytes of body elided>", len(body))
+	}
+	return string(blob)
+}
+
+// maskKeys redacts, in place, the non-blank string
+// values of keys anywhere in the decoded JSON value v.
+func maskKeys(v interface{}, keys map[string]bool) interface{} {
+	switch vt := v.(type) {
+	case map[string]interface{}:
+		for key, value := range vt {
+			if str, ok := value.(string); ok && keys[key] && str != "" {
+				vt[key] = redacted
+			} else {
+				vt[key] = maskKeys(value, keys)
+			}
+		}
+		return vt
+	case []interface{}:
+		for i, value := range vt {
+			vt[i] = maskKeys(value, keys)
+		}
+		return vt
+	default:
+		return v
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo_test
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/orijtech/goshippo/v1"
+)
+
+func TestDebugLoggingRedaction(t *testing.T) {
+	addr := &goshippo.Address{
+		Purpose:       "QUOTE",
+		AddresseeName: "Ada Lovelace",
+		Street1:       "215 Clayton St.",
+		Phone:         "+1-555-341-9393",
+		Email:         "ada@example.org",
+		Country:       "US",
+	}
+
+	tests := [...]struct {
+		level      goshippo.LogLevel
+		logPII     bool
+		wantIn     []string
+		wantNotIn  []string
+		wantLogged bool
+	}{
+		0: {level: goshippo.LogOff},
+		1: {
+			level:      goshippo.LogRequests,
+			wantLogged: true,
+			wantIn:     []string{"POST https://api.goshippo.com/addresses/", "200 OK"},
+			wantNotIn:  []string{token1, "Authorization", "QUOTE"},
+		},
+		2: {
+			level:      goshippo.LogHeaders,
+			wantLogged: true,
+			wantIn:     []string{"Authorization: ShippoToken [REDACTED]", "Content-Type: application/json"},
+			wantNotIn:  []string{token1, "QUOTE"},
+		},
+		3: {
+			level:      goshippo.LogBodies,
+			wantLogged: true,
+			wantIn:     []string{`"object_purpose":"QUOTE"`, `"name":"[REDACTED]"`, `"email":"[REDACTED]"`},
+			wantNotIn:  []string{token1, "Ada Lovelace", "ada@example.org", "+1-555-341-9393", "Clayton"},
+		},
+		4: {
+			level:      goshippo.LogBodies,
+			logPII:     true,
+			wantLogged: true,
+			wantIn:     []string{"Ada Lovelace", "ada@example.org", "Authorization: ShippoToken [REDACTED]"},
+			wantNotIn:  []string{token1},
+		},
+	}
+
+	for i, tt := range tests {
+		logBuf := new(bytes.Buffer)
+		client, err := goshippo.New(
+			goshippo.WithAPIKey(token1),
+			goshippo.WithHTTPRoundTripper(&backend{route: createAddressRoute}),
+			goshippo.WithLogger(log.New(logBuf, "", 0)),
+			goshippo.WithLogLevel(tt.level),
+		)
+		if err != nil {
+			t.Fatalf("#%d: client err: %v", i, err)
+		}
+		client.SetLogPII(tt.logPII)
+
+		if _, err := client.CreateAddress(addr); err != nil {
+			t.Fatalf("#%d: createAddress err: %v", i, err)
+		}
+
+		logs := logBuf.String()
+		if got, want := logs != "", tt.wantLogged; got != want {
+			t.Errorf("#%d: logged=%v want=%v", i, got, want)
+		}
+		for _, want := range tt.wantIn {
+			if !strings.Contains(logs, want) {
+				t.Errorf("#%d: expected %q in logs:\n%s", i, want, logs)
+			}
+		}
+		for _, unwanted := range tt.wantNotIn {
+			if strings.Contains(logs, unwanted) {
+				t.Errorf("#%d: unexpected %q in logs:\n%s", i, unwanted, logs)
+			}
+		}
+	}
+}
+
+func TestRetryLogsFollowLogLevel(t *testing.T) {
+	tests := [...]struct {
+		level           goshippo.LogLevel
+		wantRetryLogged bool
+	}{
+		0: {level: goshippo.LogOff},
+		1: {level: goshippo.LogRequests, wantRetryLogged: true},
+	}
+
+	for i, tt := range tests {
+		var attempts int
+		be := &backend{route: addressByIDRoute}
+		logBuf := new(bytes.Buffer)
+		client, err := goshippo.New(
+			goshippo.WithAPIKey(token1),
+			goshippo.WithLogger(log.New(logBuf, "", 0)),
+			goshippo.WithLogLevel(tt.level),
+			goshippo.WithHTTPRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				if attempts += 1; attempts == 1 {
+					res := makeResp("503 Service Unavailable", http.StatusServiceUnavailable)
+					res.Header.Set("Retry-After", "0")
+					return res, nil
+				}
+				return be.RoundTrip(req)
+			})),
+		)
+		if err != nil {
+			t.Fatalf("#%d: client err: %v", i, err)
+		}
+		if _, err := client.AddressByID(addrID1); err != nil {
+			t.Fatalf("#%d: addressByID err: %v", i, err)
+		}
+
+		logs := logBuf.String()
+		if got, want := strings.Contains(logs, "goshippo: retrying"), tt.wantRetryLogged; got != want {
+			t.Errorf("#%d: gotRetryLogged=%v wantRetryLogged=%v logs:\n%s", i, got, want, logs)
+		}
+		if tt.level == goshippo.LogOff && logs != "" {
+			t.Errorf("#%d: expected no logs at LogOff, got:\n%s", i, logs)
+		}
+	}
+}
+
+func TestManagedAccountLoggingRedaction(t *testing.T) {
+	logBuf := new(bytes.Buffer)
+	client, err := goshippo.New(
+		goshippo.WithAPIKey(token1),
+		goshippo.WithHTTPRoundTripper(roundTripperFunc(managedAccountRoundTrip)),
+		goshippo.WithLogger(log.New(logBuf, "", 0)),
+		goshippo.WithLogLevel(goshippo.LogBodies),
+	)
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	acct := &goshippo.ManagedAccount{Email: "ada@example.org", FirstName: "Augusta", LastName: "Lovelace", CompanyName: "Analytical Engines"}
+	if _, err := client.CreateManagedAccount(acct); err != nil {
+		t.Fatalf("createManagedAccount err: %v", err)
+	}
+
+	logs := logBuf.String()
+	for _, want := range []string{`"first_name":"[REDACTED]"`, `"last_name":"[REDACTED]"`, `"company_name":"[REDACTED]"`} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("expected %q in logs:\n%s", want, logs)
+		}
+	}
+	for _, unwanted := range []string{"Augusta", "Lovelace", "Analytical Engines", "ada@example.org"} {
+		if strings.Contains(logs, unwanted) {
+			t.Errorf("unexpected %q in logs:\n%s", unwanted, logs)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResponseInfo is the metadata of a response.
+type ResponseInfo struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int `json:"status_code"`
+
+	// RequestID is the identifier that the
+	// backend assigned to the request, if any.
+	RequestID string `json:"request_id,omitempty"`
+
+	// HasRateLimit is set if the backend sent rate limit headers,
+	// in which case the RateLimit* fields below are populated.
+	HasRateLimit bool `json:"has_rate_limit"`
+
+	// RateLimitLimit is the number of requests
+	// allowed in the current window.
+	RateLimitLimit int64 `json:"rate_limit_limit,omitempty"`
+
+	// RateLimitRemaining is the number of requests
+	// left in the current window.
+	RateLimitRemaining int64 `json:"rate_limit_remaining,omitempty"`
+
+	// RateLimitReset is when the current window ends.
+	RateLimitReset time.Time `json:"rate_limit_reset,omitempty"`
+
+	// ServerTiming is the raw Server-Timing header.
+	ServerTiming string `json:"server_timing,omitempty"`
+
+	// ServerDuration is the sum of the durations
+	// reported in the Server-Timing header.
+	ServerDuration time.Duration `json:"server_duration,omitempty"`
+
+	// Attempts is the number of requests that were
+	// sent for the call, including retried ones.
+	Attempts int `json:"attempts"`
+
+	// Header contains all the response headers.
+	Header http.Header `json:"-"`
+}
+
+// ResponseMeta collects the metadata of the last response received
+// for a call. Pass one in with WithResponseMeta and read it with
+// Snapshot, which is safe even while the call is still running,
+// e.g. while a Pager fetches pages in the background.
+type ResponseMeta struct {
+	mu   sync.Mutex
+	info ResponseInfo
+}
+
+type responseMetaCtxKey struct{}
+
+// WithResponseMeta returns a context that makes the ...Context
+// methods populate meta from the responses that they receive.
+// For calls that make several requests, such as listing pages,
+// meta holds the metadata of the most recent response.
+//
+//	meta := new(goshippo.ResponseMeta)
+//	parcel, err := client.CreateParcelContext(goshippo.WithResponseMeta(ctx, meta), parcel)
+//	if info := meta.Snapshot(); info.HasRateLimit && info.RateLimitRemaining < 10 {
+//		// Slow down until info.RateLimitReset.
+//	}
+func WithResponseMeta(ctx context.Context, meta *ResponseMeta) context.Context {
+	return context.WithValue(ctx, responseMetaCtxKey{}, meta)
+}
+
+// Snapshot returns a copy of the metadata received so far.
+func (rm *ResponseMeta) Snapshot() ResponseInfo {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	info := rm.info
+	info.Header = rm.info.Header.Clone()
+	return info
+}
+
+func responseMetaFromContext(ctx context.Context) *ResponseMeta {
+	meta, _ := ctx.Value(responseMetaCtxKey{}).(*ResponseMeta)
+	return meta
+}
+
+func (rm *ResponseMeta) recordAttempt() {
+	if rm == nil {
+		return
+	}
+	rm.mu.Lock()
+	rm.info.Attempts += 1
+	rm.mu.Unlock()
+}
+
+func (rm *ResponseMeta) recordResponse(res *http.Response, now time.Time) {
+	if rm == nil || res == nil {
+		return
+	}
+	rlh := parseRateLimitHeaders(res.Header, now)
+	serverTiming := strings.TrimSpace(res.Header.Get("Server-Timing"))
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	rm.info.StatusCode = res.StatusCode
+	rm.info.Header = res.Header
+	rm.info.RequestID = firstHeader(res.Header, "X-Request-Id", "X-Shippo-Request-Id")
+	rm.info.HasRateLimit = rlh.hasRemaining
+	rm.info.RateLimitLimit = rlh.limit
+	rm.info.RateLimitRemaining = rlh.remaining
+	rm.info.RateLimitReset = rlh.reset
+	rm.info.ServerTiming = serverTiming
+	rm.info.ServerDuration = parseServerTiming(serverTiming)
+}
+
+// parseServerTiming sums the dur parameters, which are in
+// milliseconds, of a header such as "db;dur=53, app;dur=47.2".
+func parseServerTiming(value string) time.Duration {
+	var total time.Duration
+	for _, metric := range strings.Split(value, ",") {
+		for _, param := range strings.Split(metric, ";") {
+			key, durStr, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || !strings.EqualFold(key, "dur") {
+				continue
+			}
+			if ms, err := strconv.ParseFloat(strings.Trim(durStr, `"`), 64); err == nil {
+				total += time.Duration(ms * float64(time.Millisecond))
+			}
+		}
+	}
+	return total
+}
@@ -0,0 +1,118 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/orijtech/goshippo/v1"
+)
+
+func TestResponseMeta(t *testing.T) {
+	reset := time.Now().Add(30 * time.Second).Unix()
+	be := &backend{route: addressByIDRoute}
+	client, err := goshippo.New(goshippo.WithAPIKey(token1), goshippo.WithHTTPRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		res, err := be.RoundTrip(req)
+		if res != nil {
+			res.Header.Set("X-Request-Id", "req-42")
+			res.Header.Set("X-RateLimit-Limit", "500")
+			res.Header.Set("X-RateLimit-Remaining", "12")
+			res.Header.Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+			res.Header.Set("Server-Timing", `db;dur=53, app;dur=47.5;desc="render"`)
+		}
+		return res, err
+	})))
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+
+	meta := new(goshippo.ResponseMeta)
+	ctx := goshippo.WithResponseMeta(context.Background(), meta)
+	if _, err := client.AddressByIDContext(ctx, addrID1); err != nil {
+		t.Fatalf("addressByID err: %v", err)
+	}
+
+	info := meta.Snapshot()
+	if got, want := info.StatusCode, http.StatusOK; got != want {
+		t.Errorf("gotStatusCode=%d wantStatusCode=%d", got, want)
+	}
+	if got, want := info.RequestID, "req-42"; got != want {
+		t.Errorf("gotRequestID=%q wantRequestID=%q", got, want)
+	}
+	if !info.HasRateLimit || info.RateLimitLimit != 500 || info.RateLimitRemaining != 12 {
+		t.Errorf("unexpected rate limits: has=%v limit=%d remaining=%d", info.HasRateLimit, info.RateLimitLimit, info.RateLimitRemaining)
+	}
+	if got, want := info.RateLimitReset.Unix(), reset; got != want {
+		t.Errorf("gotReset=%d wantReset=%d", got, want)
+	}
+	if got, want := info.ServerDuration, 100500*time.Microsecond; got != want {
+		t.Errorf("gotServerDuration=%s wantServerDuration=%s", got, want)
+	}
+	if got, want := info.Attempts, 1; got != want {
+		t.Errorf("gotAttempts=%d wantAttempts=%d", got, want)
+	}
+}
+
+func TestResponseMetaSnapshotWhilePaging(t *testing.T) {
+	const nAddresses = 6
+
+	var srvURL string
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+		next := "null"
+		if page < nAddresses {
+			next = fmt.Sprintf(`"%s/addresses/?limit=1&page=%d"`, srvURL, page+1)
+		}
+		rw.Header().Set("X-Request-Id", fmt.Sprintf("req-%d", page))
+		fmt.Fprintf(rw, `{"count": %d, "next": %s, "results": [{"object_id": "addr-%d"}]}`, nAddresses, next, page)
+	}))
+	defer srv.Close()
+	srvURL = srv.URL
+
+	client, err := goshippo.New(goshippo.WithAPIKey(token1), goshippo.WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	pager, err := client.NewAddressPager(&goshippo.AddressListRequest{LimitPerPage: 1, Concurrency: 3})
+	if err != nil {
+		t.Fatalf("newPager err: %v", err)
+	}
+
+	meta := new(goshippo.ResponseMeta)
+	ctx := goshippo.WithResponseMeta(context.Background(), meta)
+	var addresses int
+	for _, err := range pager.All(ctx) {
+		if err != nil {
+			t.Fatalf("listAddresses err: %v", err)
+		}
+		addresses += 1
+		// The next pages are being fetched concurrently.
+		if snap := meta.Snapshot(); snap.Attempts < 1 || snap.StatusCode != http.StatusOK {
+			t.Errorf("#%d: gotAttempts=%d gotStatusCode=%d", addresses, snap.Attempts, snap.StatusCode)
+		}
+	}
+	if addresses != nAddresses {
+		t.Errorf("gotAddresses=%d wantAddresses=%d", addresses, nAddresses)
+	}
+	if got, want := meta.Snapshot().Attempts, nAddresses; got != want {
+		t.Errorf("gotAttempts=%d wantAttempts=%d", got, want)
+	}
+}
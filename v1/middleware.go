@@ -0,0 +1,132 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Operation is a logical call made by a Client method, as seen by
+// Middleware. A method that makes other calls, such as CreateAddress
+// retrieving a replayed address, runs nested operations.
+type Operation struct {
+	// Name is that of the Client method e.g "CreateAddress", or that
+	// of the list operation e.g "ListAddresses" for pages of Pagers.
+	Name string
+
+	// Class is the class of the endpoint that the operation calls.
+	Class EndpointClass
+
+	// Request is what the operation was invoked with: the object
+	// being created or updated e.g an *Address, the ID of the
+	// object being retrieved, or the URL of the page being listed.
+	Request interface{}
+
+	// Page is the 1-based number of the page that list
+	// operations fetch, and 0 for all other operations.
+	Page uint64
+
+	// Header is added to the HTTP requests of the operation, e.g
+	// by Middleware that tags requests. It cannot override the
+	// headers that the Client sets, such as Authorization. It is
+	// never nil, so Middleware can call Header.Set right away.
+	Header http.Header
+}
+
+// Handler runs an Operation and returns its response: the object
+// that the Client method returns e.g an *Address, or a *Page for
+// list operations. Middleware that answers an Operation on its
+// own, e.g from a cache, must return a response of that same type.
+type Handler func(ctx context.Context, op *Operation) (response interface{}, err error)
+
+// Middleware wraps the Handler of every Operation of a Client,
+// to audit, measure, cache or otherwise alter them.
+type Middleware func(next Handler) Handler
+
+var (
+	errNilMiddleware = errors.New("expecting a non-nil middleware")
+
+	errMiddlewareResponse = errors.New("goshippo: middleware returned a response of the wrong type")
+)
+
+// Use adds mws to the middleware chain of the client. The first
+// middleware added is the outermost one, which sees operations first.
+func (c *Client) Use(mws ...Middleware) error {
+	for _, mw := range mws {
+		if mw == nil {
+			return errNilMiddleware
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// A fresh slice keeps the chains that are being run unchanged.
+	c.middleware = append(c.middleware[:len(c.middleware):len(c.middleware)], mws...)
+	return nil
+}
+
+// WithMiddleware is the Option equivalent of Use.
+func WithMiddleware(mws ...Middleware) Option {
+	return func(c *Client) error {
+		return c.Use(mws...)
+	}
+}
+
+type operationCtxKey struct{}
+
+func operationFromContext(ctx context.Context) *Operation {
+	op, _ := ctx.Value(operationCtxKey{}).(*Operation)
+	return op
+}
+
+// invoke runs op through the client's middleware chain, at the end
+// of which call does the work, and returns the response of the chain.
+func invoke[T any](c *Client, ctx context.Context, op *Operation, call func(context.Context) (*T, error)) (*T, error) {
+	c.mu.RLock()
+	mws := c.middleware
+	c.mu.RUnlock()
+
+	if len(mws) == 0 {
+		return call(ctx)
+	}
+	if op.Header == nil {
+		op.Header = http.Header{}
+	}
+
+	h := Handler(func(ctx context.Context, op *Operation) (interface{}, error) {
+		res, err := call(context.WithValue(ctx, operationCtxKey{}, op))
+		if res == nil {
+			// Keep nil responses nil for the middleware.
+			return nil, err
+		}
+		return res, err
+	})
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+
+	res, err := h(ctx, op)
+	if res == nil {
+		return nil, err
+	}
+	typed, ok := res.(*T)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s got %T, want %T", errMiddlewareResponse, op.Name, res, typed)
+	}
+	return typed, err
+}
@@ -0,0 +1,179 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/orijtech/goshippo/v1"
+)
+
+// auditLog records the operations that pass through its middleware.
+type auditLog struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (al *auditLog) middleware(tag string) goshippo.Middleware {
+	return func(next goshippo.Handler) goshippo.Handler {
+		return func(ctx context.Context, op *goshippo.Operation) (interface{}, error) {
+			al.add(fmt.Sprintf("%s> %s page=%d request=%T", tag, op.Name, op.Page, op.Request))
+			res, err := next(ctx, op)
+			al.add(fmt.Sprintf("<%s %s response=%T err=%v", tag, op.Name, res, err != nil))
+			return res, err
+		}
+	}
+}
+
+func (al *auditLog) add(entry string) {
+	al.mu.Lock()
+	al.entries = append(al.entries, entry)
+	al.mu.Unlock()
+}
+
+func (al *auditLog) String() string {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	return strings.Join(al.entries, "\n")
+}
+
+func TestMiddlewareChain(t *testing.T) {
+	audit := new(auditLog)
+	client, err := goshippo.New(
+		goshippo.WithAPIKey(token1),
+		goshippo.WithHTTPRoundTripper(&backend{route: listAddressesRoute}),
+		goshippo.WithMiddleware(audit.middleware("a"), audit.middleware("b")),
+	)
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+
+	pager, err := client.NewAddressPager(&goshippo.AddressListRequest{ThrottleDurationMs: goshippo.NoThrottle})
+	if err != nil {
+		t.Fatalf("newPager err: %v", err)
+	}
+	for _, err := range pager.All(context.Background()) {
+		if err != nil {
+			t.Fatalf("listAddresses err: %v", err)
+		}
+	}
+	if _, err := client.AddressByID(" "); err == nil {
+		t.Error("expected an error for a blank addressID")
+	}
+
+	want := strings.Join([]string{
+		"a> ListAddresses page=1 request=string",
+		"b> ListAddresses page=1 request=string",
+		"<b ListAddresses response=*goshippo.Page[*github.com/orijtech/goshippo/v1.Address] err=false",
+		"<a ListAddresses response=*goshippo.Page[*github.com/orijtech/goshippo/v1.Address] err=false",
+		"a> ListAddresses page=2 request=string",
+		"b> ListAddresses page=2 request=string",
+		"<b ListAddresses response=*goshippo.Page[*github.com/orijtech/goshippo/v1.Address] err=false",
+		"<a ListAddresses response=*goshippo.Page[*github.com/orijtech/goshippo/v1.Address] err=false",
+		"a> AddressByID page=0 request=string",
+		"b> AddressByID page=0 request=string",
+		"<b AddressByID response=<nil> err=true",
+		"<a AddressByID response=<nil> err=true",
+	}, "\n")
+	if got := audit.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	var requests int
+	client, err := goshippo.New(
+		goshippo.WithAPIKey(token1),
+		goshippo.WithHTTPRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			requests += 1
+			return respFromFile("./testdata/parcel-1.json")
+		})),
+	)
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	if err := client.Use(nil); err == nil {
+		t.Error("expected an error for a nil middleware")
+	}
+
+	cached := &goshippo.Parcel{ID: "cached"}
+	err = client.Use(func(next goshippo.Handler) goshippo.Handler {
+		return func(ctx context.Context, op *goshippo.Operation) (interface{}, error) {
+			switch op.Request {
+			case "cached":
+				return cached, nil
+			case "mistyped":
+				return "not a parcel", nil
+			default:
+				return next(ctx, op)
+			}
+		}
+	})
+	if err != nil {
+		t.Fatalf("use err: %v", err)
+	}
+
+	if got, err := client.ParcelByID("cached"); err != nil || got != cached {
+		t.Errorf("got=%v gotErr=%v want the cached parcel", got, err)
+	}
+	if requests != 0 {
+		t.Errorf("gotRequests=%d wantRequests=0", requests)
+	}
+	if _, err := client.ParcelByID("mistyped"); err == nil {
+		t.Error("expected an error for a response of the wrong type")
+	}
+	if got, err := client.ParcelByID("adcfdddf8ec64b84ad22772bce3ea37a"); err != nil || got.ID == "cached" {
+		t.Errorf("got=%v gotErr=%v want a fetched parcel", got, err)
+	}
+	if requests != 1 {
+		t.Errorf("gotRequests=%d wantRequests=1", requests)
+	}
+}
+
+func TestMiddlewareHeaders(t *testing.T) {
+	var gotHeaders http.Header
+	tagger := func(next goshippo.Handler) goshippo.Handler {
+		return func(ctx context.Context, op *goshippo.Operation) (interface{}, error) {
+			op.Header.Set("X-Merchant", "merchant-7")
+			op.Header.Set("Authorization", "ShippoToken stolen")
+			return next(ctx, op)
+		}
+	}
+	client, err := goshippo.New(
+		goshippo.WithAPIKey(token1),
+		goshippo.WithMiddleware(tagger),
+		goshippo.WithHTTPRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			gotHeaders = req.Header.Clone()
+			return respFromFile("./testdata/parcel-1.json")
+		})),
+	)
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	if _, err := client.ParcelByID("adcfdddf8ec64b84ad22772bce3ea37a"); err != nil {
+		t.Fatalf("parcelByID err: %v", err)
+	}
+	if got := gotHeaders.Get("X-Merchant"); got != "merchant-7" {
+		t.Errorf("gotMerchant=%q wantMerchant=%q", got, "merchant-7")
+	}
+	if got, want := gotHeaders.Get("Authorization"), "ShippoToken "+token1; got != want {
+		t.Errorf("gotAuth=%q wantAuth=%q", got, want)
+	}
+}
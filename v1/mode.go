@@ -0,0 +1,205 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Mode is either test or live. Objects created with a test
+// token are free and can't be mixed with live objects.
+type Mode string
+
+const (
+	ModeUnknown Mode = ""
+	ModeTest    Mode = "test"
+	ModeLive    Mode = "live"
+)
+
+const (
+	testTokenPrefix = "shippo_test_"
+	liveTokenPrefix = "shippo_live_"
+
+	// maxTrackedObjectModes bounds the memory used
+	// to remember the modes of the objects seen.
+	maxTrackedObjectModes = 10000
+)
+
+var (
+	ErrLivePurchaseNotArmed = errors.New("refusing to purchase a label in live mode without ArmLivePurchases")
+
+	ErrMixedModes = errors.New("cannot mix test and live objects in one request")
+)
+
+// ModeOfToken returns the Mode of a GoShippo API token,
+// or ModeUnknown if the token doesn't have a known prefix.
+func ModeOfToken(token string) Mode {
+	token = strings.TrimSpace(token)
+	switch {
+	case strings.HasPrefix(token, testTokenPrefix):
+		return ModeTest
+	case strings.HasPrefix(token, liveTokenPrefix):
+		return ModeLive
+	default:
+		return ModeUnknown
+	}
+}
+
+func modeOfTestFlag(inTestMode bool) Mode {
+	if inTestMode {
+		return ModeTest
+	}
+	return ModeLive
+}
+
+// Mode returns the Mode of the client's API token.
+func (c *Client) Mode() Mode {
+	return ModeOfToken(c.apiKey())
+}
+
+// modeOf returns the Mode of the API token that
+// requests made with ctx are authenticated with.
+func (c *Client) modeOf(ctx context.Context) Mode {
+	_, token, _ := c.token(ctx)
+	return ModeOfToken(token)
+}
+
+// SetLivePurchaseGuard if set to true makes the client refuse
+// to purchase labels, unless the context passed to the purchasing
+// method was armed with ArmLivePurchases. Clients whose token is
+// in test mode are unaffected.
+func (c *Client) SetLivePurchaseGuard(enabled bool) {
+	c.mu.Lock()
+	c.livePurchaseGuard = enabled
+	c.mu.Unlock()
+}
+
+type livePurchasesArmedCtxKey struct{}
+
+// ArmLivePurchases returns a context that allows label purchases
+// on a client that has the live purchase guard enabled.
+func ArmLivePurchases(ctx context.Context) context.Context {
+	return context.WithValue(ctx, livePurchasesArmedCtxKey{}, true)
+}
+
+func livePurchasesArmed(ctx context.Context) bool {
+	armed, _ := ctx.Value(livePurchasesArmedCtxKey{}).(bool)
+	return armed
+}
+
+// checkPurchaseGuard returns ErrLivePurchaseNotArmed for label
+// purchases that are not in test mode, if the guard is enabled.
+// Tokens of unknown mode are treated as live ones.
+func (c *Client) checkPurchaseGuard(req *http.Request) error {
+	if req.Method != "POST" || endpointClassOf(req.URL) != EndpointTransactions {
+		return nil
+	}
+	c.mu.RLock()
+	enabled := c.livePurchaseGuard
+	c.mu.RUnlock()
+
+	if !enabled || c.modeOf(req.Context()) == ModeTest || livePurchasesArmed(req.Context()) {
+		return nil
+	}
+	return ErrLivePurchaseNotArmed
+}
+
+// RecordObjectMode remembers the mode of the object with objectID so
+// that requests which reference it fail with ErrMixedModes if their
+// token or other objects are of the other mode. The client records
+// the modes of the objects that it creates or fetches one by one,
+// including the Rates of Transactions, by itself. This is for the
+// objects that it doesn't fetch, such as Shipments and their Rates.
+// The least recently used modes are forgotten past 10,000 objects.
+func (c *Client) RecordObjectMode(objectID string, mode Mode) {
+	if objectID == "" || mode == ModeUnknown {
+		return
+	}
+	c.mu.Lock()
+	c.objectModes.record(objectID, mode)
+	c.mu.Unlock()
+}
+
+// objectModes remembers the modes of up to maxTrackedObjectModes
+// objects, evicting the least recently used one past that.
+// Its zero value is ready to use.
+type objectModes struct {
+	byID  map[string]*list.Element
+	order list.List // Of *objectMode, the most recently used first.
+}
+
+type objectMode struct {
+	id   string
+	mode Mode
+}
+
+func (om *objectModes) record(id string, mode Mode) {
+	if elem, ok := om.byID[id]; ok {
+		elem.Value.(*objectMode).mode = mode
+		om.order.MoveToFront(elem)
+		return
+	}
+	if om.byID == nil {
+		om.byID = make(map[string]*list.Element)
+	}
+	if om.order.Len() >= maxTrackedObjectModes {
+		oldest := om.order.Back()
+		om.order.Remove(oldest)
+		delete(om.byID, oldest.Value.(*objectMode).id)
+	}
+	om.byID[id] = om.order.PushFront(&objectMode{id: id, mode: mode})
+}
+
+func (om *objectModes) lookup(id string) (Mode, bool) {
+	elem, ok := om.byID[id]
+	if !ok {
+		return ModeUnknown, false
+	}
+	om.order.MoveToFront(elem)
+	return elem.Value.(*objectMode).mode, true
+}
+
+// checkSameMode returns ErrMixedModes if, amongst the token that
+// requests made with ctx use and the objects with ids, there are
+// both test and live ones. Only the objects whose modes were
+// recorded are checked.
+func (c *Client) checkSameMode(ctx context.Context, ids ...string) error {
+	byMode := make(map[Mode][]string)
+	if mode := c.modeOf(ctx); mode != ModeUnknown {
+		byMode[mode] = append(byMode[mode], "token")
+	}
+
+	// Lookups count as uses, so they need the write lock.
+	c.mu.Lock()
+	for _, id := range ids {
+		if mode, ok := c.objectModes.lookup(id); ok {
+			byMode[mode] = append(byMode[mode], id)
+		}
+	}
+	c.mu.Unlock()
+
+	if len(byMode[ModeTest]) == 0 || len(byMode[ModeLive]) == 0 {
+		return nil
+	}
+	sort.Strings(byMode[ModeTest])
+	sort.Strings(byMode[ModeLive])
+	return fmt.Errorf("%w: test=%q live=%q", ErrMixedModes, byMode[ModeTest], byMode[ModeLive])
+}
@@ -0,0 +1,227 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/orijtech/goshippo/v1"
+)
+
+func TestModeOfToken(t *testing.T) {
+	tests := [...]struct {
+		token string
+		want  goshippo.Mode
+	}{
+		0: {token: "", want: goshippo.ModeUnknown},
+		1: {token: token1, want: goshippo.ModeUnknown},
+		2: {token: "shippo_test_abcdef", want: goshippo.ModeTest},
+		3: {token: "  shippo_live_abcdef ", want: goshippo.ModeLive},
+	}
+
+	for i, tt := range tests {
+		if got := goshippo.ModeOfToken(tt.token); got != tt.want {
+			t.Errorf("#%d: gotMode=%q wantMode=%q", i, got, tt.want)
+		}
+	}
+}
+
+func TestLivePurchaseGuard(t *testing.T) {
+	tests := [...]struct {
+		token   string
+		guard   bool
+		arm     bool
+		wantErr error
+	}{
+		0: {token: "shippo_live_abcdef", guard: true, wantErr: goshippo.ErrLivePurchaseNotArmed},
+		1: {token: "shippo_live_abcdef", guard: true, arm: true},
+		2: {token: "shippo_live_abcdef", guard: false},
+		3: {token: "shippo_test_abcdef", guard: true},
+		// Unknown tokens could be live ones.
+		4: {token: token1, guard: true, wantErr: goshippo.ErrLivePurchaseNotArmed},
+	}
+
+	for i, tt := range tests {
+		var purchases int
+		client, err := goshippo.New(goshippo.WithAPIKey(tt.token), goshippo.WithHTTPRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			purchases += 1
+			res := makeResp("201 Created", http.StatusCreated)
+			body := fmt.Sprintf(`{"object_id": "tx-1", "status": "SUCCESS", "test": %v}`, strings.Contains(tt.token, "test"))
+			res.Body = ioutil.NopCloser(strings.NewReader(body))
+			return res, nil
+		})))
+		if err != nil {
+			t.Fatalf("#%d: client err: %v", i, err)
+		}
+		client.SetLivePurchaseGuard(tt.guard)
+
+		ctx := context.Background()
+		if tt.arm {
+			ctx = goshippo.ArmLivePurchases(ctx)
+		}
+		_, err = client.CreateTransactionContext(ctx, &goshippo.Transaction{Rate: "rate-1"})
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("#%d: gotErr=%v wantErr=%v", i, err, tt.wantErr)
+			}
+			if purchases != 0 {
+				t.Errorf("#%d: the purchase should not have been sent", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: gotErr=%v", i, err)
+		}
+		if purchases != 1 {
+			t.Errorf("#%d: gotPurchases=%d wantPurchases=1", i, purchases)
+		}
+	}
+}
+
+func TestMixedModes(t *testing.T) {
+	const (
+		liveKey = "shippo_live_abcdef"
+		testKey = "shippo_test_abcdef"
+	)
+	var purchases int
+	client, err := goshippo.New(goshippo.WithAPIKey(testKey), goshippo.WithHTTPRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		purchases += 1
+		sent := new(goshippo.Transaction)
+		if err := json.NewDecoder(req.Body).Decode(sent); err != nil {
+			return makeResp(err.Error(), http.StatusBadRequest), nil
+		}
+		inTestMode := strings.Contains(req.Header.Get("Authorization"), testKey)
+		res := makeResp("201 Created", http.StatusCreated)
+		body := fmt.Sprintf(`{"object_id": "tx-%d", "rate": %q, "status": "SUCCESS", "test": %v}`, purchases, sent.Rate, inTestMode)
+		res.Body = ioutil.NopCloser(strings.NewReader(body))
+		return res, nil
+	})))
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+
+	// The Rate of a test mode purchase is recorded as a test object.
+	if _, err := client.CreateTransaction(&goshippo.Transaction{Rate: "rate-test"}); err != nil {
+		t.Fatalf("test purchase err: %v", err)
+	}
+	// Rates from Shipments that the client didn't fetch are recorded explicitly.
+	client.RecordObjectMode("rate-live", goshippo.ModeLive)
+
+	tests := [...]struct {
+		key     string
+		rate    string
+		wantErr error
+	}{
+		0: {key: liveKey, rate: "rate-test", wantErr: goshippo.ErrMixedModes},
+		1: {key: testKey, rate: "rate-live", wantErr: goshippo.ErrMixedModes},
+		2: {key: liveKey, rate: "rate-live"},
+		3: {key: testKey, rate: "rate-test"},
+		// Objects of unknown mode aren't checked.
+		4: {key: liveKey, rate: "rate-unknown"},
+	}
+
+	for i, tt := range tests {
+		client.SetAPIKey(tt.key)
+		before := purchases
+		_, err := client.CreateTransaction(&goshippo.Transaction{Rate: tt.rate})
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("#%d: gotErr=%v wantErr=%v", i, err, tt.wantErr)
+		}
+		wantSent := 1
+		if tt.wantErr != nil {
+			wantSent = 0
+		}
+		if got := purchases - before; got != wantSent {
+			t.Errorf("#%d: gotSent=%d wantSent=%d", i, got, wantSent)
+		}
+	}
+}
+
+func TestObjectModesOutliveLargeLists(t *testing.T) {
+	const (
+		liveKey   = "shippo_live_abcdef"
+		testKey   = "shippo_test_abcdef"
+		nListed   = 10001
+		nFillers  = 9998
+		purchased = `{"object_id": "tx-1", "rate": "rate-1", "status": "SUCCESS", "test": true}`
+	)
+	var addresses []string
+	for i := 0; i < nListed; i++ {
+		addresses = append(addresses, fmt.Sprintf(`{"object_id": "addr-%d", "test": false}`, i))
+	}
+	listing := fmt.Sprintf(`{"count": %d, "next": null, "results": [%s]}`, nListed, strings.Join(addresses, ","))
+
+	var purchases int
+	client, err := goshippo.New(goshippo.WithAPIKey(liveKey), goshippo.WithHTTPRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		res := makeResp("200 OK", http.StatusOK)
+		body := listing
+		if req.Method == "POST" {
+			purchases += 1
+			body = purchased
+		}
+		res.Body = ioutil.NopCloser(strings.NewReader(body))
+		return res, nil
+	})))
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	client.RecordObjectMode("rate-old", goshippo.ModeLive)
+	client.RecordObjectMode("rate-used", goshippo.ModeLive)
+
+	// Listing more objects than are remembered forgets none of them.
+	pager, err := client.NewAddressPager(&goshippo.ListRequest{})
+	if err != nil {
+		t.Fatalf("newPager err: %v", err)
+	}
+	for _, err := range pager.All(context.Background()) {
+		if err != nil {
+			t.Fatalf("listAddresses err: %v", err)
+		}
+	}
+
+	client.SetAPIKey(testKey)
+	for i := 0; i < nFillers; i++ {
+		client.RecordObjectMode(fmt.Sprintf("filler-%d", i), goshippo.ModeLive)
+	}
+	if _, err := client.CreateTransaction(&goshippo.Transaction{Rate: "rate-used"}); !errors.Is(err, goshippo.ErrMixedModes) {
+		t.Fatalf("gotErr=%v wantErr=%v", err, goshippo.ErrMixedModes)
+	}
+	// Only the least recently used mode is forgotten for a new one.
+	client.RecordObjectMode("filler-last", goshippo.ModeLive)
+
+	tests := [...]struct {
+		rate    string
+		wantErr error
+	}{
+		0: {rate: "rate-used", wantErr: goshippo.ErrMixedModes},
+		1: {rate: "filler-0", wantErr: goshippo.ErrMixedModes},
+		2: {rate: "rate-old"},
+	}
+	for i, tt := range tests {
+		if _, err := client.CreateTransaction(&goshippo.Transaction{Rate: tt.rate}); !errors.Is(err, tt.wantErr) {
+			t.Errorf("#%d: gotErr=%v wantErr=%v", i, err, tt.wantErr)
+		}
+	}
+	if purchases != 1 {
+		t.Errorf("gotPurchases=%d wantPurchases=1", purchases)
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/orijtech/otils"
+)
+
+const (
+	defaultOAuthAuthorizeURL = "https://goshippo.com/oauth/authorize"
+	defaultOAuthTokenURL     = "https://goshippo.com/oauth/access_token"
+
+	defaultOAuthScope = "*"
+
+	defaultOAuthTimeout = 30 * time.Second
+)
+
+// OAuthConfig describes a Shippo app, through which merchants
+// connect their Shippo accounts using OAuth:
+//
+//  1. Redirect the merchant to the URL returned by AuthCodeURL,
+//     remembering the state e.g in a cookie of their session.
+//  2. Once they are redirected back to the app, pass the
+//     request and the remembered state to ExchangeCallback.
+//  3. Make calls on their behalf with the Client returned by
+//     Client, or with WithTenant and Tenant.AccessToken.
+type OAuthConfig struct {
+	ClientID     string
+	ClientSecret string
+
+	// Scope is the scope of the access requested, "*" if blank.
+	Scope string
+
+	// AuthorizeURL and TokenURL are the endpoints of the
+	// authorization server, those of goshippo.com if blank.
+	// They can be set to those of a stand-in server in tests.
+	AuthorizeURL string
+	TokenURL     string
+
+	// Transport sends the token requests,
+	// http.DefaultTransport if nil.
+	Transport http.RoundTripper
+
+	// Timeout bounds each token request, 30 seconds if zero.
+	// The deadline of the context passed in applies as well.
+	Timeout time.Duration
+}
+
+// OAuthToken is the access token that a merchant granted an app.
+// Shippo access tokens don't expire, although they can be revoked.
+type OAuthToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	Scope       string `json:"scope"`
+}
+
+var _ TokenSource = (*OAuthToken)(nil)
+
+func (tok *OAuthToken) Token(ctx context.Context) (string, error) {
+	if tok == nil || tok.AccessToken == "" {
+		return "", errBlankAccessToken
+	}
+	return tok.AccessToken, nil
+}
+
+var (
+	// ErrOAuthStateMismatch means that the state of an OAuth callback
+	// isn't the one the flow was started with, which is what
+	// cross-site request forgery looks like.
+	ErrOAuthStateMismatch = errors.New("goshippo: the OAuth state does not match")
+
+	// ErrOAuthDenied means that the merchant, or the authorization
+	// server, declined to grant access to the app.
+	ErrOAuthDenied = errors.New("goshippo: OAuth access was denied")
+
+	errBlankClientID     = errors.New("expecting a non-blank client ID")
+	errBlankClientSecret = errors.New("expecting a non-blank client secret")
+	errBlankOAuthState   = errors.New("expecting a non-blank OAuth state")
+	errBlankOAuthCode    = errors.New("expecting a non-blank authorization code")
+	errBlankAccessToken  = errors.New("expecting a non-blank access token")
+)
+
+// NewOAuthState returns a random, unguessable state for an OAuth flow.
+func NewOAuthState() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// AuthCodeURL returns the URL that merchants are sent to, to grant the
+// app access to their account, and the state that is expected back
+// in the callback. The state must be kept where only the merchant's
+// session can get to it, for ExchangeCallback to check it against.
+func (oc *OAuthConfig) AuthCodeURL() (authURL, state string, err error) {
+	if strings.TrimSpace(oc.ClientID) == "" {
+		return "", "", errBlankClientID
+	}
+	state, err = NewOAuthState()
+	if err != nil {
+		return "", "", err
+	}
+	parsed, err := url.Parse(otils.FirstNonEmptyString(oc.AuthorizeURL, defaultOAuthAuthorizeURL))
+	if err != nil {
+		return "", "", err
+	}
+	qv := parsed.Query()
+	qv.Set("response_type", "code")
+	qv.Set("client_id", oc.ClientID)
+	qv.Set("scope", otils.FirstNonEmptyString(oc.Scope, defaultOAuthScope))
+	qv.Set("state", state)
+	parsed.RawQuery = qv.Encode()
+	return parsed.String(), state, nil
+}
+
+// ExchangeCallback checks that the state of the callback request req,
+// to which the merchant was redirected, is wantState and if so,
+// exchanges its authorization code for an access token.
+func (oc *OAuthConfig) ExchangeCallback(ctx context.Context, req *http.Request, wantState string) (*OAuthToken, error) {
+	if wantState == "" {
+		return nil, errBlankOAuthState
+	}
+	qv := req.URL.Query()
+	if subtle.ConstantTimeCompare([]byte(qv.Get("state")), []byte(wantState)) != 1 {
+		return nil, ErrOAuthStateMismatch
+	}
+	if code := qv.Get("error"); code != "" {
+		if desc := qv.Get("error_description"); desc != "" {
+			return nil, fmt.Errorf("%w: %s: %s", ErrOAuthDenied, code, desc)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrOAuthDenied, code)
+	}
+	return oc.Exchange(ctx, qv.Get("code"))
+}
+
+// Exchange exchanges the authorization code of a
+// callback, whose state was checked, for an access token.
+func (oc *OAuthConfig) Exchange(ctx context.Context, code string) (*OAuthToken, error) {
+	switch {
+	case strings.TrimSpace(oc.ClientID) == "":
+		return nil, errBlankClientID
+	case strings.TrimSpace(oc.ClientSecret) == "":
+		return nil, errBlankClientSecret
+	case strings.TrimSpace(code) == "":
+		return nil, errBlankOAuthCode
+	}
+
+	form := url.Values{
+		"client_id":     {oc.ClientID},
+		"client_secret": {oc.ClientSecret},
+		"code":          {code},
+		"grant_type":    {"authorization_code"},
+	}
+	tokenURL := otils.FirstNonEmptyString(oc.TokenURL, defaultOAuthTokenURL)
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	timeout := oc.Timeout
+	if timeout <= 0 {
+		timeout = defaultOAuthTimeout
+	}
+	res, err := (&http.Client{Transport: oc.Transport, Timeout: timeout}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	err = readBody(buf, res.Body, DefaultMaxResponseBytes)
+	if !otils.StatusOK(res.StatusCode) {
+		return nil, makeAPIError(res, append([]byte(nil), buf.Bytes()...))
+	}
+	if err != nil {
+		return nil, err
+	}
+	tok := new(OAuthToken)
+	if err := json.Unmarshal(buf.Bytes(), tok); err != nil {
+		return nil, err
+	}
+	if tok.AccessToken == "" {
+		return nil, errBlankAccessToken
+	}
+	return tok, nil
+}
+
+// Client returns a client, configured by opts, that
+// makes calls on behalf of the merchant who granted tok.
+func (oc *OAuthConfig) Client(tok *OAuthToken, opts ...Option) (*Client, error) {
+	if tok == nil || tok.AccessToken == "" {
+		return nil, errBlankAccessToken
+	}
+	// A copy, lest the token source be written into the spare
+	// capacity of the caller's slice.
+	return New(append(append([]Option(nil), opts...), WithOAuthTokenSource(tok))...)
+}
+
+// SetOAuthTokenSource makes the client authenticate every
+// request with the OAuth access token supplied by ts, as a
+// Bearer token, in place of the key it was created with.
+func (c *Client) SetOAuthTokenSource(ts TokenSource) error {
+	return c.setTokenSource(ts, schemeBearer)
+}
+
+// WithOAuthTokenSource is the Option equivalent of SetOAuthTokenSource.
+// An *OAuthToken is a TokenSource of its own access token.
+func WithOAuthTokenSource(ts TokenSource) Option {
+	return func(c *Client) error {
+		return c.SetOAuthTokenSource(ts)
+	}
+}
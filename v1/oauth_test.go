@@ -0,0 +1,215 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/orijtech/goshippo/v1"
+)
+
+// tokenServer is a stand-in OAuth authorization server
+// that grants "oauth.granted" for the code "code-1".
+func tokenServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil {
+			t.Errorf("parseForm err: %v", err)
+		}
+		form := req.PostForm
+		rw.Header().Set("Content-Type", "application/json")
+		switch {
+		case req.Method != "POST" || req.URL.Path != "/oauth/access_token":
+			rw.WriteHeader(http.StatusNotFound)
+		case form.Get("client_id") != "app-1" || form.Get("client_secret") != "secret-1":
+			rw.WriteHeader(http.StatusUnauthorized)
+			rw.Write([]byte(`{"error": "invalid_client"}`))
+		case form.Get("grant_type") != "authorization_code" || form.Get("code") != "code-1":
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(`{"error": "invalid_grant"}`))
+		default:
+			json.NewEncoder(rw).Encode(map[string]string{"access_token": "oauth.granted", "token_type": "bearer", "scope": "*"})
+		}
+	}))
+}
+
+func TestOAuthAuthCodeURL(t *testing.T) {
+	oc := &goshippo.OAuthConfig{ClientID: "app-1", AuthorizeURL: "https://auth.example.org/oauth/authorize?app=x"}
+	authURL, state, err := oc.AuthCodeURL()
+	if err != nil {
+		t.Fatalf("authCodeURL err: %v", err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse err: %v", err)
+	}
+	wantQuery := map[string]string{"response_type": "code", "client_id": "app-1", "scope": "*", "state": state, "app": "x"}
+	for key, want := range wantQuery {
+		if got := parsed.Query().Get(key); got != want {
+			t.Errorf("query %q: got=%q want=%q", key, got, want)
+		}
+	}
+	if parsed.Host != "auth.example.org" || len(state) < 32 {
+		t.Errorf("unexpected authURL=%q state=%q", authURL, state)
+	}
+
+	_, state2, _ := oc.AuthCodeURL()
+	if state2 == state {
+		t.Error("expecting every flow to get its own state")
+	}
+	if _, _, err := (&goshippo.OAuthConfig{}).AuthCodeURL(); err == nil {
+		t.Error("expected an error for a blank client ID")
+	}
+}
+
+func TestOAuthExchangeCallback(t *testing.T) {
+	ts := tokenServer(t)
+	defer ts.Close()
+
+	oc := &goshippo.OAuthConfig{ClientID: "app-1", ClientSecret: "secret-1", TokenURL: ts.URL + "/oauth/access_token"}
+
+	tests := [...]struct {
+		query     string
+		wantState string
+		secret    string
+		wantErr   error
+		anyErr    bool
+	}{
+		0: {query: "code=code-1&state=s1", wantState: "s1"},
+		1: {query: "code=code-1&state=forged", wantState: "s1", wantErr: goshippo.ErrOAuthStateMismatch},
+		2: {query: "code=code-1", wantState: "s1", wantErr: goshippo.ErrOAuthStateMismatch},
+		3: {query: "code=code-1&state=", wantState: "", anyErr: true},
+		4: {query: "error=access_denied&state=s1", wantState: "s1", wantErr: goshippo.ErrOAuthDenied},
+		5: {query: "code=code-2&state=s1", wantState: "s1", anyErr: true},
+		6: {query: "code=code-1&state=s1", wantState: "s1", secret: "wrong", anyErr: true},
+		7: {query: "state=s1", wantState: "s1", anyErr: true},
+	}
+
+	for i, tt := range tests {
+		cfg := *oc
+		if tt.secret != "" {
+			cfg.ClientSecret = tt.secret
+		}
+		req := httptest.NewRequest("GET", "https://app.example.org/shippo/callback?"+tt.query, nil)
+		tok, err := cfg.ExchangeCallback(context.Background(), req, tt.wantState)
+		if tt.wantErr != nil || tt.anyErr {
+			if err == nil {
+				t.Errorf("#%d: expected a non-nil error", i)
+			} else if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("#%d: gotErr=%v wantErr=%v", i, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: gotErr=%v", i, err)
+			continue
+		}
+		if tok.AccessToken != "oauth.granted" || tok.TokenType != "bearer" {
+			t.Errorf("#%d: unexpected token %+v", i, tok)
+		}
+	}
+}
+
+func TestOAuthExchangeTimeout(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	oc := &goshippo.OAuthConfig{
+		ClientID:     "app-1",
+		ClientSecret: "secret-1",
+		TokenURL:     ts.URL + "/oauth/access_token",
+		Timeout:      50 * time.Millisecond,
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := oc.Exchange(context.Background(), "code-1")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("expected a timeout error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Exchange did not time out")
+	}
+}
+
+func TestOAuthClientSendsBearer(t *testing.T) {
+	var mu sync.Mutex
+	var gotAuth []string
+	rt := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		gotAuth = append(gotAuth, req.Header.Get("Authorization"))
+		mu.Unlock()
+		return respFromFile("./testdata/parcel-1.json")
+	})
+
+	oc := &goshippo.OAuthConfig{ClientID: "app-1", ClientSecret: "secret-1"}
+	client, err := oc.Client(&goshippo.OAuthToken{AccessToken: "oauth.granted"}, goshippo.WithHTTPRoundTripper(rt))
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	if _, err := oc.Client(nil); err == nil {
+		t.Error("expected an error for a nil token")
+	}
+
+	// The options of the caller, and their spare capacity, are left alone.
+	opts := make([]goshippo.Option, 1, 2)
+	opts[0] = goshippo.WithHTTPRoundTripper(rt)
+	if _, err := oc.Client(&goshippo.OAuthToken{AccessToken: "oauth.other"}, opts...); err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	if spare := opts[:2][1]; spare != nil {
+		t.Error("the token source was written into the caller's options")
+	}
+
+	const parcelID = "adcfdddf8ec64b84ad22772bce3ea37a"
+	if _, err := client.ParcelByID(parcelID); err != nil {
+		t.Fatalf("parcelByID err: %v", err)
+	}
+
+	// Tenants can bring their own access token to a pooled client.
+	pooled, err := goshippo.New(goshippo.WithAPIKey(token1), goshippo.WithHTTPRoundTripper(rt))
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	ctx := goshippo.WithTenant(context.Background(), goshippo.Tenant{ID: "merchant-1", AccessToken: "oauth.merchant-1"})
+	if _, err := pooled.ParcelByIDContext(ctx, parcelID); err != nil {
+		t.Fatalf("parcelByID err: %v", err)
+	}
+	if _, err := pooled.ParcelByID(parcelID); err != nil {
+		t.Fatalf("parcelByID err: %v", err)
+	}
+
+	want := []string{"Bearer oauth.granted", "Bearer oauth.merchant-1", "ShippoToken " + token1}
+	if strings.Join(gotAuth, "|") != strings.Join(want, "|") {
+		t.Errorf("gotAuth=%q wantAuth=%q", gotAuth, want)
+	}
+}
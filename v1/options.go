@@ -0,0 +1,203 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Option configures a Client created by New.
+type Option func(*Client) error
+
+// Logger is satisfied by *log.Logger.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+const userAgent = "goshippo-go/v1"
+
+var (
+	errNilOption        = errors.New("expecting a non-nil option")
+	errNegativeTimeout  = errors.New("expecting a non-negative timeout")
+	errNegativeMaxBytes = errors.New("expecting a non-negative maximum response size")
+	errBlankAPIKeyOpt   = errors.New("expecting a non-blank API key")
+	errBlankAPIVersion  = errors.New("expecting a non-blank API version")
+	errInvalidUserAgent = errors.New("user agent cannot contain newlines")
+)
+
+// New creates a Client configured by opts. If no API key is passed
+// in through WithAPIKey or WithTokenSource, it is read from the
+// GOSHIPPO_TOKEN environment variable, just like NewClientFromEnv does.
+func New(opts ...Option) (*Client, error) {
+	c := new(Client)
+	for _, opt := range opts {
+		if opt == nil {
+			return nil, errNilOption
+		}
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	if c.tokenSource == nil && c.__apiKey == "" {
+		token := strings.TrimSpace(os.Getenv(envGoShippoToken))
+		if token == "" {
+			return nil, errBlankShippoToken
+		}
+		c.__apiKey = token
+	}
+	return c, nil
+}
+
+func WithAPIKey(key string) Option {
+	return func(c *Client) error {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return errBlankAPIKeyOpt
+		}
+		c.__apiKey = key
+		return nil
+	}
+}
+
+// WithTokenSource is the Option equivalent of SetTokenSource.
+func WithTokenSource(ts TokenSource) Option {
+	return func(c *Client) error {
+		return c.SetTokenSource(ts)
+	}
+}
+
+// WithBaseURL is the Option equivalent of SetBaseURL.
+func WithBaseURL(rawURL string) Option {
+	return func(c *Client) error {
+		return c.SetBaseURL(rawURL)
+	}
+}
+
+// WithHTTPTimeout sets the time limit for every HTTP request made by
+// the Client, including reading the response body. A timeout of 0
+// means no timeout, although contexts passed to the ...Context
+// methods still apply.
+func WithHTTPTimeout(timeout time.Duration) Option {
+	return func(c *Client) error {
+		if timeout < 0 {
+			return errNegativeTimeout
+		}
+		c.timeout = timeout
+		return nil
+	}
+}
+
+// WithMaxResponseBytes sets the size past which response bodies
+// are rejected with ErrResponseTooLarge. A max of 0 means
+// DefaultMaxResponseBytes.
+func WithMaxResponseBytes(max int64) Option {
+	return func(c *Client) error {
+		if max < 0 {
+			return errNegativeMaxBytes
+		}
+		c.maxBodyBytes = max
+		return nil
+	}
+}
+
+// WithUserAgent appends suffix to the User-Agent
+// header that the Client sends with every request.
+func WithUserAgent(suffix string) Option {
+	return func(c *Client) error {
+		if strings.ContainsAny(suffix, "\r\n") {
+			return errInvalidUserAgent
+		}
+		c.userAgentSuffix = strings.TrimSpace(suffix)
+		return nil
+	}
+}
+
+// WithAPIVersion pins the GoShippo API version by sending it
+// in the Shippo-API-Version header with every request. Without
+// it, the default version configured for the account is used.
+func WithAPIVersion(version APIVersion) Option {
+	return func(c *Client) error {
+		if strings.TrimSpace(string(version)) == "" {
+			return errBlankAPIVersion
+		}
+		c.SetAPIVersion(version)
+		return nil
+	}
+}
+
+func WithHTTPRoundTripper(rt http.RoundTripper) Option {
+	return func(c *Client) error {
+		c.rt = rt
+		return nil
+	}
+}
+
+func WithLogger(logger Logger) Option {
+	return func(c *Client) error {
+		c.logger = logger
+		return nil
+	}
+}
+
+func WithLogLevel(level LogLevel) Option {
+	return func(c *Client) error {
+		c.logLevel = level
+		return nil
+	}
+}
+
+func WithRetryPolicy(rp *RetryPolicy) Option {
+	return func(c *Client) error {
+		c.retryPolicy = rp
+		return nil
+	}
+}
+
+func WithRateLimiter(rl *RateLimiter) Option {
+	return func(c *Client) error {
+		c.rateLimiter = rl
+		return nil
+	}
+}
+
+func WithJournal(j Journal) Option {
+	return func(c *Client) error {
+		c.journal = j
+		return nil
+	}
+}
+
+func (c *Client) userAgent() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.userAgentSuffix == "" {
+		return userAgent
+	}
+	return userAgent + " " + c.userAgentSuffix
+}
+
+// logf logs events such as retries, which
+// are only logged from LogRequests up.
+func (c *Client) logf(format string, args ...interface{}) {
+	logger, level, _ := c.logSettings()
+	if logger != nil && level >= LogRequests {
+		logger.Printf(format, args...)
+	}
+}
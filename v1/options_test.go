@@ -0,0 +1,87 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo_test
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/orijtech/goshippo/v1"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	t.Setenv("GOSHIPPO_TOKEN", "")
+
+	if _, err := goshippo.New(); err == nil {
+		t.Error("expected an error when no API key is available")
+	}
+	if _, err := goshippo.New(goshippo.WithHTTPTimeout(-1 * time.Second)); err == nil {
+		t.Error("expected an error for a negative timeout")
+	}
+	if _, err := goshippo.New(goshippo.WithAPIKey(token1), goshippo.WithBaseURL("ftp://example.org")); err == nil {
+		t.Error("expected an error for an invalid base URL")
+	}
+	if _, err := goshippo.New(goshippo.WithAPIKey(token1), goshippo.WithAPIVersion(" ")); err == nil {
+		t.Error("expected an error for a blank API version")
+	}
+
+	var gotHeaders http.Header
+	be := &backend{route: addressByIDRoute}
+	rt := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		gotHeaders = req.Header.Clone()
+		return be.RoundTrip(req)
+	})
+
+	client, err := goshippo.New(
+		goshippo.WithAPIKey(token2),
+		goshippo.WithHTTPRoundTripper(rt),
+		goshippo.WithHTTPTimeout(5*time.Second),
+		goshippo.WithUserAgent("fulfilment/1.2"),
+		goshippo.WithAPIVersion(" 2018-02-08 "),
+		goshippo.WithLogger(log.New(ioutil.Discard, "", 0)),
+	)
+	if err != nil {
+		t.Fatalf("new client err: %v", err)
+	}
+	if got, want := client.APIVersion(), goshippo.APIVersion20180208; got != want {
+		t.Errorf("gotVersion=%q wantVersion=%q", got, want)
+	}
+	if _, err := client.AddressByID(addrID1); err != nil {
+		t.Fatalf("addressByID err: %v", err)
+	}
+
+	wantHeaders := map[string]string{
+		"Authorization":      "ShippoToken " + token2,
+		"User-Agent":         "goshippo-go/v1 fulfilment/1.2",
+		"Shippo-Api-Version": "2018-02-08",
+	}
+	for key, want := range wantHeaders {
+		if got := gotHeaders.Get(key); got != want {
+			t.Errorf("header %q: got=%q want=%q", key, got, want)
+		}
+	}
+
+	// Existing constructors keep working.
+	t.Setenv("GOSHIPPO_TOKEN", token1)
+	if _, err := goshippo.NewClientFromEnv(); err != nil {
+		t.Errorf("newClientFromEnv err: %v", err)
+	}
+	if _, err := goshippo.New(); err != nil {
+		t.Errorf("new should fall back to the environment: %v", err)
+	}
+}
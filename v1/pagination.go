@@ -0,0 +1,590 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/orijtech/otils"
+)
+
+const (
+	NoThrottle = -1
+
+	defaultThrottle = 150 * time.Millisecond
+)
+
+// ListRequest configures the paging of a list endpoint.
+type ListRequest struct {
+	MaxPages     uint64 `json:"max_pages"`
+	LimitPerPage uint64 `json:"limit_per_page"`
+	PageToken    string `json:"page_token"`
+	PageNumber   uint64 `json:"page_number"`
+
+	// ThrottleDurationMs is the pause between fetching two
+	// consecutive pages. It defaults to 150ms, use NoThrottle
+	// to fetch pages back to back.
+	ThrottleDurationMs int64 `json:"throttle_duration_ms"`
+
+	// PrefetchPages is the number of pages that channel based
+	// listings fetch ahead of the consumer. By default, a page
+	// is only fetched once the previous one has been received.
+	PrefetchPages int `json:"prefetch_pages"`
+
+	// Concurrency if greater than 1 makes the pager fetch upto
+	// Concurrency pages at a time, after the first page, still
+	// delivering them in order. The pages are fetched within the
+	// rate limit of the client and without ThrottleDurationMs.
+	Concurrency int `json:"concurrency"`
+}
+
+type pager struct {
+	Count      uint64 `json:"count"`
+	Limit      uint64 `json:"limit"`
+	PageNumber uint64 `json:"page"`
+}
+
+func pagerFromListRequest(lReq *ListRequest) *pager {
+	pg := &pager{Limit: lReq.LimitPerPage, PageNumber: lReq.PageNumber}
+	if pg.PageNumber <= 0 {
+		// PageNumbers are 1-based for goshippo
+		pg.PageNumber = 1
+	}
+	return pg
+}
+
+func (lReq *ListRequest) throttle() time.Duration {
+	switch {
+	case lReq.ThrottleDurationMs == NoThrottle:
+		return 0
+	case lReq.ThrottleDurationMs > 0:
+		return time.Duration(lReq.ThrottleDurationMs) * time.Millisecond
+	default:
+		return defaultThrottle
+	}
+}
+
+// Page is a single page of results from a list endpoint.
+type Page[T any] struct {
+	// Number is the 1-based number of the page.
+	Number uint64 `json:"number"`
+
+	// Count is the total number of objects
+	// that the backend reports for the list.
+	Count uint64 `json:"count"`
+
+	Items []T `json:"items"`
+
+	PreviousToken string `json:"previous_token,omitempty"`
+	NextToken     string `json:"next_token,omitempty"`
+}
+
+type listWrap[T any] struct {
+	Count         uint64               `json:"count"`
+	PreviousToken otils.NullableString `json:"previous"`
+	NextToken     otils.NullableString `json:"next"`
+	Results       []T                  `json:"results"`
+}
+
+// Pager walks the pages of a list endpoint. Use Next, Page and Err
+// to walk it a page at a time, or Pages and All to range over it:
+//
+//	for addr, err := range pager.All(ctx) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// A Pager is not safe for concurrent use.
+type Pager[T any] struct {
+	c          *Client
+	method     string
+	class      EndpointClass
+	throttle   time.Duration
+	maxPages   uint64
+	prefetch   int
+	onResults  func([]T)
+	static     []*Page[T]
+	nextURL    string
+	fetched    uint64
+	lastNumber uint64
+
+	// For concurrent paging, template is the URL of the pages,
+	// which are fetched ahead of the consumer upto lastPage.
+	concurrency int
+	template    *url.URL
+	lastPage    uint64
+	nextAhead   uint64
+	ahead       []*pageAhead[T]
+
+	count uint64
+	page  *Page[T]
+	err   error
+	done  bool
+}
+
+var errPageTokenNotURL = errors.New("page token must be an absolute URL")
+
+// validatePageToken ensures that a page token, which for GoShippo
+// is the full URL of the page, points at the client's base URL so
+// that API tokens can't be leaked to other hosts.
+func (c *Client) validatePageToken(token string) error {
+	parsedURL, err := url.Parse(token)
+	if err != nil {
+		return err
+	}
+	if !parsedURL.IsAbs() {
+		return errPageTokenNotURL
+	}
+
+	parsedBaseURL := c.parsedBaseURL()
+	var errsList []string
+	if got, want := parsedURL.Host, parsedBaseURL.Host; got != want {
+		errsList = append(errsList, fmt.Sprintf("gotHost=%q wantHost=%q", got, want))
+	}
+	if got, want := parsedURL.Scheme, parsedBaseURL.Scheme; got != want {
+		errsList = append(errsList, fmt.Sprintf("gotScheme=%q wantSchem=%q", got, want))
+	}
+	if basePath := parsedBaseURL.Path; basePath != "" && !strings.HasPrefix(parsedURL.Path, basePath+"/") {
+		errsList = append(errsList, fmt.Sprintf("gotPath=%q wantPathPrefix=%q", parsedURL.Path, basePath))
+	}
+	if len(errsList) > 0 {
+		return errors.New(strings.Join(errsList, "\n"))
+	}
+	return nil
+}
+
+// newPager creates a Pager for the list endpoint at path, e.g
+// "addresses", whose calls are traced as method.
+func newPager[T any](c *Client, method string, class EndpointClass, path string, lReq *ListRequest) (*Pager[T], error) {
+	if lReq == nil {
+		lReq = new(ListRequest)
+	}
+
+	var fullURL string
+	if lReq.PageToken != "" {
+		// GoShippo PageTokens are full URLs e.g
+		// https://api.goshippo.com/addresses/?limit=1&page=2
+		fullURL = lReq.PageToken
+	} else {
+		pg := pagerFromListRequest(lReq)
+		qv, err := otils.ToURLValues(pg)
+		if err != nil {
+			return nil, err
+		}
+		fullURL = fmt.Sprintf("%s/%s/", c.baseURL(), path)
+		if len(qv) > 0 {
+			fullURL += "?" + qv.Encode()
+		}
+	}
+
+	// Ensure that fullURL parses upfront since insertion of tokens
+	// could trip out if they aren't proper URLs.
+	if err := c.validatePageToken(fullURL); err != nil {
+		return nil, err
+	}
+
+	return &Pager[T]{
+		c:        c,
+		method:   method,
+		class:    class,
+		throttle: lReq.throttle(),
+		maxPages: lReq.MaxPages,
+		prefetch: lReq.PrefetchPages,
+		nextURL:  fullURL,
+
+		concurrency: lReq.Concurrency,
+	}, nil
+}
+
+// pageNumberOf returns the page query parameter of
+// pageURL, or fallback if it doesn't have a valid one.
+func pageNumberOf(pageURL string, fallback uint64) uint64 {
+	parsed, err := url.Parse(pageURL)
+	if err != nil {
+		return fallback
+	}
+	if number, err := strconv.ParseUint(parsed.Query().Get("page"), 10, 64); err == nil && number > 0 {
+		return number
+	}
+	return fallback
+}
+
+// Next fetches the next page, which is then available from Page.
+// It returns false once there are no more pages or on error, after
+// which Err reports the error, if any.
+func (p *Pager[T]) Next(ctx context.Context) bool {
+	if p.done {
+		return false
+	}
+	if p.maxPages > 0 && p.fetched >= p.maxPages {
+		p.done = true
+		return false
+	}
+	if p.template != nil {
+		return p.nextConcurrently(ctx)
+	}
+	if p.fetched > 0 {
+		if err := sleepContext(ctx, p.throttle); err != nil {
+			p.err, p.done = err, true
+			return false
+		}
+	}
+
+	page, err := p.fetchPage(ctx, p.nextURL, p.lastNumber+1)
+	if err != nil {
+		p.err, p.done = err, true
+		return false
+	}
+	p.fetched += 1
+	p.lastNumber = page.Number
+	p.page, p.count = page, page.Count
+
+	// Now setting nextURL to be the next token because
+	// GoShippo page tokens are literally fullURLs e.g:
+	//  https://api.goshippo.com/addresses/?limit=1&page=2
+	p.nextURL = page.NextToken
+	if len(page.Items) == 0 {
+		p.nextURL = ""
+	}
+	if p.nextURL == "" {
+		p.done = true
+	} else if p.concurrency > 1 {
+		p.planAhead(page)
+	}
+	return true
+}
+
+// pageAhead is a page being fetched ahead of the consumer.
+type pageAhead[T any] struct {
+	number uint64
+	url    string
+	cancel context.CancelFunc
+	result chan pageResult[T]
+}
+
+type pageResult[T any] struct {
+	page *Page[T]
+	err  error
+}
+
+// planAhead prepares concurrent paging from the first page. GoShippo
+// page tokens are URLs with "page" and "limit" query parameters, so
+// the URLs of all the pages can be derived from the next token and
+// the count. If they can't, paging carries on sequentially.
+func (p *Pager[T]) planAhead(first *Page[T]) {
+	if err := p.c.validatePageToken(p.nextURL); err != nil {
+		return
+	}
+	template, err := url.Parse(p.nextURL)
+	if err != nil {
+		return
+	}
+	number, err := strconv.ParseUint(template.Query().Get("page"), 10, 64)
+	if err != nil || number != first.Number+1 {
+		return
+	}
+	limit, err := strconv.ParseUint(template.Query().Get("limit"), 10, 64)
+	if err != nil || limit == 0 {
+		limit = uint64(len(first.Items))
+	}
+	if limit == 0 || first.Count == 0 {
+		return
+	}
+
+	p.template = template
+	p.lastPage = (first.Count + limit - 1) / limit
+	p.nextAhead = number
+}
+
+func (p *Pager[T]) pageURL(number uint64) string {
+	u := *p.template
+	qv := u.Query()
+	qv.Set("page", strconv.FormatUint(number, 10))
+	u.RawQuery = qv.Encode()
+	return u.String()
+}
+
+// fillAhead keeps upto concurrency pages in flight.
+func (p *Pager[T]) fillAhead(ctx context.Context) {
+	for len(p.ahead) < p.concurrency && p.nextAhead <= p.lastPage {
+		if p.maxPages > 0 && p.fetched+uint64(len(p.ahead)) >= p.maxPages {
+			return
+		}
+		fetchCtx, cancel := context.WithCancel(ctx)
+		pa := &pageAhead[T]{
+			number: p.nextAhead,
+			url:    p.pageURL(p.nextAhead),
+			cancel: cancel,
+			result: make(chan pageResult[T], 1),
+		}
+		go func() {
+			page, err := p.fetch(fetchCtx, pa.url, pa.number)
+			pa.result <- pageResult[T]{page: page, err: err}
+		}()
+		p.ahead = append(p.ahead, pa)
+		p.nextAhead += 1
+	}
+}
+
+func (p *Pager[T]) stopAhead() {
+	for _, pa := range p.ahead {
+		pa.cancel()
+	}
+	p.ahead = nil
+}
+
+func (p *Pager[T]) nextConcurrently(ctx context.Context) bool {
+	p.fillAhead(ctx)
+	if len(p.ahead) == 0 {
+		p.nextURL, p.done = "", true
+		return false
+	}
+
+	head := p.ahead[0]
+	p.ahead = p.ahead[1:]
+	p.nextURL = head.url
+	defer head.cancel()
+
+	var res pageResult[T]
+	select {
+	case res = <-head.result:
+	case <-ctx.Done():
+		res.err = ctx.Err()
+	}
+	if res.err != nil {
+		p.err, p.done = res.err, true
+		p.stopAhead()
+		return false
+	}
+
+	page := res.page
+	p.fetched += 1
+	p.lastNumber = page.Number
+	p.page, p.count = page, page.Count
+	if len(page.Items) == 0 || page.NextToken == "" || head.number >= p.lastPage {
+		p.nextURL, p.done = "", true
+		p.stopAhead()
+	} else {
+		p.nextURL = p.pageURL(head.number + 1)
+	}
+	return true
+}
+
+// NewStaticPager returns a Pager over pages of items that are already
+// in memory, for instance for mocks of the methods that return Pagers.
+func NewStaticPager[T any](pages ...[]T) *Pager[T] {
+	p := &Pager[T]{static: make([]*Page[T], len(pages))}
+	var count uint64
+	for _, items := range pages {
+		count += uint64(len(items))
+	}
+	for i, items := range pages {
+		page := &Page[T]{Number: uint64(i + 1), Count: count, Items: items}
+		if i > 0 {
+			page.PreviousToken = strconv.Itoa(i)
+		}
+		if i+1 < len(pages) {
+			page.NextToken = strconv.Itoa(i + 2)
+		}
+		p.static[i] = page
+	}
+	if len(pages) > 0 {
+		p.nextURL = "1"
+	} else {
+		p.done = true
+	}
+	return p
+}
+
+func (p *Pager[T]) fetchPage(ctx context.Context, pageURL string, number uint64) (*Page[T], error) {
+	if p.static == nil {
+		return p.fetch(ctx, pageURL, number)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	i, err := strconv.Atoi(pageURL)
+	if err != nil || i < 1 || i > len(p.static) {
+		return nil, errPageTokenNotURL
+	}
+	return p.static[i-1], nil
+}
+
+func (p *Pager[T]) fetch(ctx context.Context, pageURL string, number uint64) (_ *Page[T], err error) {
+	ctx, release, err := p.c.startPager(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	ctx, endOp := startOp(ctx, p.method, p.class)
+	defer func() { endOp(err) }()
+
+	op := &Operation{Name: p.method, Class: p.class, Request: pageURL, Page: pageNumberOf(pageURL, number)}
+	return invoke(p.c, ctx, op, func(ctx context.Context) (*Page[T], error) {
+		// Tokens from the backend are validated just like
+		// those from callers, in case of a misbehaving proxy.
+		if err := p.c.validatePageToken(pageURL); err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		wrap := new(listWrap[T])
+		if _, err := p.c.doAuthAndReq(req, wrap); err != nil {
+			return nil, err
+		}
+		if p.onResults != nil {
+			p.onResults(wrap.Results)
+		}
+		return &Page[T]{
+			Number:        op.Page,
+			Count:         wrap.Count,
+			Items:         wrap.Results,
+			PreviousToken: string(wrap.PreviousToken),
+			NextToken:     string(wrap.NextToken),
+		}, nil
+	})
+}
+
+// Page returns the page fetched by the last successful call to Next.
+func (p *Pager[T]) Page() *Page[T] {
+	return p.page
+}
+
+// Err returns the error, if any, that stopped the Pager.
+func (p *Pager[T]) Err() error {
+	return p.err
+}
+
+// Count returns the total number of objects, as
+// reported by the backend with the last page.
+func (p *Pager[T]) Count() uint64 {
+	return p.count
+}
+
+// ResumeToken returns the token of the next page to fetch, which can
+// be passed in as a ListRequest.PageToken to resume paging later on.
+// It is empty once there are no more pages.
+func (p *Pager[T]) ResumeToken() string {
+	return p.nextURL
+}
+
+// Pages returns an iterator over the remaining pages. If paging
+// fails, the last pair yielded carries the error and a nil page.
+func (p *Pager[T]) Pages(ctx context.Context) iter.Seq2[*Page[T], error] {
+	return func(yield func(*Page[T], error) bool) {
+		for p.Next(ctx) {
+			if !yield(p.Page(), nil) {
+				return
+			}
+		}
+		if err := p.Err(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// All returns an iterator over the objects of the remaining pages.
+// If paging fails, the last pair yielded carries the error.
+func (p *Pager[T]) All(ctx context.Context) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for page, err := range p.Pages(ctx) {
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			for _, item := range page.Items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// stream walks the pages of p in a goroutine, delivering them converted
+// by wrap on the returned channel, which is closed once paging stops.
+// Paging stops on the first error, which is delivered too, once the
+// returned cancel func is called, once ctx is done or once the client
+// is closed, even if the goroutine is blocked on a send.
+func stream[T, P any](ctx context.Context, p *Pager[T], wrap func(*Page[T], error) P) (<-chan P, func() error, error) {
+	ctx, release, err := p.c.startPager(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	prefetch := p.prefetch
+	if prefetch < 0 {
+		prefetch = 0
+	}
+	pagesChan := make(chan P, prefetch)
+
+	ctx, cancel := context.WithCancel(ctx)
+	var cancelOnce sync.Once
+	cancelFn := func() error {
+		var err error = errAlreadyClosed
+		cancelOnce.Do(func() {
+			cancel()
+			err = nil
+		})
+		return err
+	}
+
+	go func() {
+		defer release()
+		defer cancel()
+		defer close(pagesChan)
+
+		// send delivers page to the consumer, returning
+		// false if paging was cancelled in the meantime.
+		send := func(page P) bool {
+			select {
+			case pagesChan <- page:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for page, err := range p.Pages(ctx) {
+			if err != nil {
+				if ctx.Err() == nil {
+					send(wrap(nil, err))
+				}
+				return
+			}
+			if !send(wrap(page, nil)) {
+				return
+			}
+		}
+	}()
+
+	return pagesChan, cancelFn, nil
+}
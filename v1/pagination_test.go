@@ -0,0 +1,378 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/orijtech/goshippo/v1"
+)
+
+func TestAddressPager(t *testing.T) {
+	client, err := goshippo.NewClient(token1)
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	client.SetHTTPRoundTripper(&backend{route: listAddressesRoute})
+
+	tests := [...]struct {
+		req             *goshippo.AddressListRequest
+		wantAddresses   int
+		wantPages       []uint64
+		wantResumeToken string
+		wantErr         bool
+	}{
+		0: {req: &goshippo.AddressListRequest{}, wantAddresses: 6, wantPages: []uint64{1, 2}},
+		1: {
+			req:             &goshippo.AddressListRequest{MaxPages: 1},
+			wantAddresses:   5,
+			wantPages:       []uint64{1},
+			wantResumeToken: "https://api.goshippo.com/addresses/?page=2",
+		},
+		2: {
+			req:           &goshippo.AddressListRequest{PageToken: "https://api.goshippo.com/addresses/?page=2"},
+			wantAddresses: 1,
+			wantPages:     []uint64{2},
+		},
+		// No such page in the testdata.
+		3: {req: &goshippo.AddressListRequest{PageNumber: 10}, wantErr: true},
+	}
+
+	ctx := context.Background()
+	for i, tt := range tests {
+		tt.req.ThrottleDurationMs = goshippo.NoThrottle
+		pager, err := client.NewAddressPager(tt.req)
+		if err != nil {
+			t.Errorf("#%d: newPager err: %v", i, err)
+			continue
+		}
+
+		var gotPages []uint64
+		var nAddresses int
+		for page, err := range pager.Pages(ctx) {
+			if err != nil {
+				break
+			}
+			gotPages = append(gotPages, page.Number)
+			nAddresses += len(page.Items)
+		}
+
+		if tt.wantErr {
+			if pager.Err() == nil {
+				t.Errorf("#%d: expected a non-nil error", i)
+			}
+			continue
+		}
+		if err := pager.Err(); err != nil {
+			t.Errorf("#%d: gotErr=%v", i, err)
+			continue
+		}
+		if got, want := len(gotPages), len(tt.wantPages); got != want {
+			t.Errorf("#%d: gotPages=%v wantPages=%v", i, gotPages, tt.wantPages)
+			continue
+		}
+		for j := range gotPages {
+			if gotPages[j] != tt.wantPages[j] {
+				t.Errorf("#%d: gotPages=%v wantPages=%v", i, gotPages, tt.wantPages)
+				break
+			}
+		}
+		if nAddresses != tt.wantAddresses {
+			t.Errorf("#%d: gotAddresses=%d wantAddresses=%d", i, nAddresses, tt.wantAddresses)
+		}
+		if got, want := pager.Count(), uint64(6); got != want {
+			t.Errorf("#%d: gotCount=%d wantCount=%d", i, got, want)
+		}
+		if got, want := pager.ResumeToken(), tt.wantResumeToken; got != want {
+			t.Errorf("#%d: gotResumeToken=%q wantResumeToken=%q", i, got, want)
+		}
+	}
+}
+
+func TestPagerAll(t *testing.T) {
+	client, err := goshippo.NewClient(token1)
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	client.SetHTTPRoundTripper(&backend{route: listAddressesRoute})
+
+	pager, err := client.NewAddressPager(&goshippo.AddressListRequest{ThrottleDurationMs: goshippo.NoThrottle})
+	if err != nil {
+		t.Fatalf("newPager err: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for addr, err := range pager.All(context.Background()) {
+		if err != nil {
+			t.Fatalf("all err: %v", err)
+		}
+		seen[addr.ID] = true
+		// Stopping early must not fetch any more pages.
+		if len(seen) == 3 {
+			break
+		}
+	}
+	if got, want := len(seen), 3; got != want {
+		t.Errorf("gotAddresses=%d wantAddresses=%d", got, want)
+	}
+	if got, want := pager.Page().Number, uint64(1); got != want {
+		t.Errorf("gotPageNumber=%d wantPageNumber=%d", got, want)
+	}
+}
+
+func TestClientCloseStopsPagers(t *testing.T) {
+	client, err := goshippo.NewClient(token1)
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	client.SetHTTPRoundTripper(&backend{route: listAddressesRoute})
+
+	var pagers []*goshippo.AddressesPager
+	for i := 0; i < 3; i++ {
+		res, err := client.ListAddresses(&goshippo.AddressListRequest{ThrottleDurationMs: goshippo.NoThrottle})
+		if err != nil {
+			t.Fatalf("#%d: listAddresses err: %v", i, err)
+		}
+		pagers = append(pagers, res)
+	}
+
+	// None of the pages are read, leaving the
+	// paging goroutines blocked on their sends.
+	closed := make(chan error)
+	go func() { closed <- client.Close() }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatalf("close err: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close did not stop the pagers")
+	}
+
+	for i, res := range pagers {
+		for range res.Pages {
+		}
+		if err := res.Cancel(); err != nil {
+			t.Errorf("#%d: cancel err: %v", i, err)
+		}
+	}
+
+	if _, err := client.ListAddresses(nil); !errors.Is(err, goshippo.ErrClientClosed) {
+		t.Errorf("gotErr=%v wantErr=%v", err, goshippo.ErrClientClosed)
+	}
+	pager, err := client.NewAddressPager(nil)
+	if err != nil {
+		t.Fatalf("newPager err: %v", err)
+	}
+	if pager.Next(context.Background()) || !errors.Is(pager.Err(), goshippo.ErrClientClosed) {
+		t.Errorf("gotErr=%v wantErr=%v", pager.Err(), goshippo.ErrClientClosed)
+	}
+}
+
+func TestCancelUnblocksSend(t *testing.T) {
+	client, err := goshippo.NewClient(token1)
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	client.SetHTTPRoundTripper(&backend{route: listAddressesRoute})
+
+	res, err := client.ListAddresses(&goshippo.AddressListRequest{ThrottleDurationMs: goshippo.NoThrottle})
+	if err != nil {
+		t.Fatalf("listAddresses err: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := res.Cancel(); err != nil {
+		t.Fatalf("cancel err: %v", err)
+	}
+	if err := res.Cancel(); err == nil {
+		t.Errorf("expected an error from cancelling twice")
+	}
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case _, ok := <-res.Pages:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("paging goroutine did not exit after Cancel")
+		}
+	}
+}
+
+func TestPrefetchPages(t *testing.T) {
+	var mu sync.Mutex
+	var fetches int
+	be := &backend{route: listAddressesRoute}
+	client, err := goshippo.New(goshippo.WithAPIKey(token1), goshippo.WithHTTPRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		fetches += 1
+		mu.Unlock()
+		return be.RoundTrip(req)
+	})))
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	defer client.Close()
+
+	res, err := client.ListAddresses(&goshippo.AddressListRequest{
+		ThrottleDurationMs: goshippo.NoThrottle,
+		PrefetchPages:      2,
+	})
+	if err != nil {
+		t.Fatalf("listAddresses err: %v", err)
+	}
+
+	// Both pages should be fetched without any being read.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		n := fetches
+		mu.Unlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("gotFetches=%d wantFetches=2", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var pageNumbers []uint64
+	for page := range res.Pages {
+		if page.Err != nil {
+			t.Fatalf("page err: %v", page.Err)
+		}
+		pageNumbers = append(pageNumbers, page.PageNumber)
+	}
+	if len(pageNumbers) != 2 || pageNumbers[0] != 1 || pageNumbers[1] != 2 {
+		t.Errorf("gotPages=%v wantPages=[1 2]", pageNumbers)
+	}
+}
+
+func TestConcurrentPaging(t *testing.T) {
+	const nAddresses, limit = 19, 2
+
+	var mu sync.Mutex
+	var inFlight, maxInFlight int
+	var srvURL string
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		inFlight += 1
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			inFlight -= 1
+			mu.Unlock()
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+		var results []string
+		for i := (page - 1) * limit; i < page*limit && i < nAddresses; i++ {
+			results = append(results, fmt.Sprintf(`{"object_id": "addr-%d"}`, i))
+		}
+		next := "null"
+		if page*limit < nAddresses {
+			next = fmt.Sprintf(`"%s/addresses/?limit=%d&page=%d"`, srvURL, limit, page+1)
+		}
+		fmt.Fprintf(rw, `{"count": %d, "next": %s, "previous": null, "results": [%s]}`, nAddresses, next, strings.Join(results, ","))
+	}))
+	defer srv.Close()
+	srvURL = srv.URL
+
+	tests := [...]struct {
+		req           *goshippo.AddressListRequest
+		wantAddresses int
+		wantMaxFlight int
+	}{
+		0: {req: &goshippo.AddressListRequest{LimitPerPage: limit}, wantAddresses: nAddresses, wantMaxFlight: 1},
+		1: {req: &goshippo.AddressListRequest{LimitPerPage: limit, Concurrency: 4}, wantAddresses: nAddresses, wantMaxFlight: 4},
+		2: {req: &goshippo.AddressListRequest{LimitPerPage: limit, Concurrency: 4, MaxPages: 3}, wantAddresses: 3 * limit, wantMaxFlight: 2},
+	}
+
+	for i, tt := range tests {
+		client, err := goshippo.New(goshippo.WithAPIKey(token1), goshippo.WithBaseURL(srv.URL))
+		if err != nil {
+			t.Fatalf("#%d: client err: %v", i, err)
+		}
+		mu.Lock()
+		maxInFlight = 0
+		mu.Unlock()
+
+		tt.req.ThrottleDurationMs = goshippo.NoThrottle
+		pager, err := client.NewAddressPager(tt.req)
+		if err != nil {
+			t.Fatalf("#%d: newPager err: %v", i, err)
+		}
+		var ids []string
+		for addr, err := range pager.All(context.Background()) {
+			if err != nil {
+				t.Fatalf("#%d: all err: %v", i, err)
+			}
+			ids = append(ids, addr.ID)
+		}
+
+		if got, want := len(ids), tt.wantAddresses; got != want {
+			t.Errorf("#%d: gotAddresses=%d wantAddresses=%d", i, got, want)
+		}
+		for j, id := range ids {
+			if want := fmt.Sprintf("addr-%d", j); id != want {
+				t.Errorf("#%d: out of order: gotID=%q wantID=%q", i, id, want)
+				break
+			}
+		}
+		mu.Lock()
+		if maxInFlight != tt.wantMaxFlight {
+			t.Errorf("#%d: gotMaxInFlight=%d wantMaxInFlight=%d", i, maxInFlight, tt.wantMaxFlight)
+		}
+		mu.Unlock()
+		client.Close()
+	}
+}
+
+func TestStaticPager(t *testing.T) {
+	pager := goshippo.NewStaticPager([]string{"a", "b"}, []string{"c"})
+
+	var got []string
+	for item, err := range pager.All(context.Background()) {
+		if err != nil {
+			t.Fatalf("all err: %v", err)
+		}
+		got = append(got, item)
+	}
+	if strings.Join(got, ",") != "a,b,c" {
+		t.Errorf("gotItems=%v wantItems=[a b c]", got)
+	}
+	if got, want := pager.Count(), uint64(3); got != want {
+		t.Errorf("gotCount=%d wantCount=%d", got, want)
+	}
+	if pager.Next(context.Background()) || pager.Err() != nil {
+		t.Errorf("expecting an exhausted pager, gotErr=%v", pager.Err())
+	}
+}
@@ -16,16 +16,22 @@ package goshippo
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
 	"net/http"
-	"reflect"
+	"strings"
 	"time"
 )
 
 type Parcel struct {
+	// Purpose is only used by API versions
+	// before 2017-03-29 and unpinned clients.
+	// It is not sent to the backend for later versions.
+	Purpose string `json:"object_purpose,omitempty"`
+
 	State ParcelState `json:"object_state"`
 
 	// Date and time of Parcel creation.
@@ -78,40 +84,112 @@ type Parcel struct {
 	Metadata string `json:"metadata"`
 
 	Extra *ParcelExtra `json:"extra"`
+
+	// InTestMode indicates whether the
+	// object has been created in test mode.
+	InTestMode bool `json:"test"`
 }
 
 var blankParcel Parcel
 
 func (c *Client) CreateParcel(parcel *Parcel) (*Parcel, error) {
-	if err := parcel.Validate(); err != nil {
-		return nil, err
-	}
+	return c.CreateParcelContext(context.Background(), parcel)
+}
 
-	blob, err := json.Marshal(parcel)
-	if err != nil {
-		return nil, err
-	}
-	fullURL := fmt.Sprintf("%s/parcels/", baseURL)
-	req, err := http.NewRequest("POST", fullURL, bytes.NewReader(blob))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
+func (c *Client) CreateParcelContext(ctx context.Context, parcel *Parcel) (_ *Parcel, err error) {
+	ctx, endOp := startOp(ctx, "CreateParcel", EndpointParcels)
+	defer func() { endOp(err) }()
+
+	return invoke(c, ctx, &Operation{Name: "CreateParcel", Class: EndpointParcels, Request: parcel}, func(ctx context.Context) (*Parcel, error) {
+		if err := parcel.Validate(); err != nil {
+			return nil, err
+		}
+
+		key, replayedID, err := c.replayedID(ctx, EndpointParcels)
+		if err != nil {
+			return nil, err
+		}
+		if replayedID != "" {
+			return c.ParcelByIDContext(ctx, replayedID)
+		}
+
+		blob, err := json.Marshal(parcel.forVersion(c.APIVersion()))
+		if err != nil {
+			return nil, err
+		}
+		fullURL := fmt.Sprintf("%s/parcels/", c.baseURL())
+		req, err := http.NewRequestWithContext(ctx, "POST", fullURL, bytes.NewReader(blob))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(idempotencyKeyHeader, key)
+
+		recvParcel, err := c.doReqAndParcel(req)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.recordCreated(ctx, EndpointParcels, key, recvParcel.ID); err != nil {
+			return recvParcel, err
+		}
+		return recvParcel, nil
+	})
+}
+
+func (c *Client) ParcelByID(parcelID string) (*Parcel, error) {
+	return c.ParcelByIDContext(context.Background(), parcelID)
+}
 
-	blob, _, err = c.doAuthAndReq(req)
+func (c *Client) ParcelByIDContext(ctx context.Context, parcelID string) (_ *Parcel, err error) {
+	ctx, endOp := startOp(ctx, "ParcelByID", EndpointParcels)
+	defer func() { endOp(err) }()
+
+	return invoke(c, ctx, &Operation{Name: "ParcelByID", Class: EndpointParcels, Request: parcelID}, func(ctx context.Context) (*Parcel, error) {
+		parcelID = strings.TrimSpace(parcelID)
+		if parcelID == "" {
+			return nil, errEmptyParcelID
+		}
+		fullURL := fmt.Sprintf("%s/parcels/%s/", c.baseURL(), parcelID)
+		req, err := http.NewRequestWithContext(ctx, "GET", fullURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		return c.doReqAndParcel(req)
+	})
+}
+
+// NewParcelPager returns a Pager over the parcels of the account.
+func (c *Client) NewParcelPager(plReq *ListRequest) (*Pager[*Parcel], error) {
+	p, err := newPager[*Parcel](c, "ListParcels", EndpointParcels, "parcels", plReq)
 	if err != nil {
 		return nil, err
 	}
+	return p, nil
+}
+
+func (c *Client) doReqAndParcel(req *http.Request) (*Parcel, error) {
 	recvParcel := new(Parcel)
-	if err := json.Unmarshal(blob, recvParcel); err != nil {
+	if _, err := c.doAuthAndReq(req, recvParcel); err != nil {
 		return nil, err
 	}
-	if reflect.DeepEqual(*recvParcel, blankParcel) {
+	if *recvParcel == blankParcel {
 		return nil, errBlankParcelFromServer
 	}
+	c.RecordObjectMode(recvParcel.ID, modeOfTestFlag(recvParcel.InTestMode))
 	return recvParcel, nil
 }
 
+// forVersion returns the representation of p
+// that should be sent to a backend using version.
+func (p *Parcel) forVersion(version APIVersion) *Parcel {
+	if version.usesObjectPurpose() || p.Purpose == "" {
+		return p
+	}
+	stripped := *p
+	stripped.Purpose = ""
+	return &stripped
+}
+
 func zeroOrNegativeFloat64(f64 float64) bool {
 	return math.Abs(f64-0.0) <= 0.0
 }
@@ -125,6 +203,8 @@ var (
 	errBlankMassUnit     = errors.New("expecting a non-blank mass unit")
 
 	errBlankParcelFromServer = errors.New("got back a blank parcel from the server")
+
+	errEmptyParcelID = errors.New("expecting a non-empty parcelID")
 )
 
 func (p *Parcel) Validate() error {
@@ -0,0 +1,345 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EndpointClass groups GoShippo endpoints that share a rate limit budget.
+type EndpointClass string
+
+const (
+	EndpointDefault      EndpointClass = ""
+	EndpointAddresses    EndpointClass = "addresses"
+	EndpointParcels      EndpointClass = "parcels"
+	EndpointShipments    EndpointClass = "shipments"
+	EndpointRates        EndpointClass = "rates"
+	EndpointTransactions EndpointClass = "transactions"
+	EndpointTracking     EndpointClass = "tracks"
+	EndpointAccounts     EndpointClass = "shippo-accounts"
+)
+
+var knownEndpointClasses = map[string]EndpointClass{
+	string(EndpointAddresses):    EndpointAddresses,
+	string(EndpointParcels):      EndpointParcels,
+	string(EndpointShipments):    EndpointShipments,
+	string(EndpointRates):        EndpointRates,
+	string(EndpointTransactions): EndpointTransactions,
+	string(EndpointTracking):     EndpointTracking,
+	string(EndpointAccounts):     EndpointAccounts,
+}
+
+// endpointClassOf returns the class of the first path segment
+// that names a known endpoint, so that prefixed paths such
+// as /proxy/addresses/ are still classified correctly.
+func endpointClassOf(u *url.URL) EndpointClass {
+	if u == nil {
+		return EndpointDefault
+	}
+	for _, seg := range strings.Split(u.Path, "/") {
+		if class, ok := knownEndpointClasses[seg]; ok {
+			return class
+		}
+	}
+	return EndpointDefault
+}
+
+// Rate is the budget of a token bucket.
+type Rate struct {
+	// PerSecond is the sustained number of requests
+	// allowed per second. Values <= 0 mean unlimited.
+	PerSecond float64 `json:"per_second"`
+
+	// Burst is the maximum number of requests that can be
+	// made at once after a period of inactivity.
+	Burst int `json:"burst"`
+}
+
+// RateLimiter is a client side token bucket rate limiter with
+// a separate budget per EndpointClass. It is safe for concurrent
+// use and can be shared by many Clients that use the same account.
+// It adapts to the X-RateLimit-* and Retry-After response headers
+// by slowing down, or pausing, the affected endpoint class. Calls
+// made on behalf of a Tenant have budgets of their own, since every
+// account is rate limited separately by the backend. Budgets that sit
+// idle are dropped, so serving many tenants doesn't grow it unbounded.
+type RateLimiter struct {
+	mu          sync.Mutex
+	defaultRate Rate
+	rates       map[EndpointClass]Rate
+	buckets     map[bucketKey]*tokenBucket
+
+	// sweepAt is the number of buckets past which the
+	// idle ones are dropped, see sweepLocked.
+	sweepAt int
+
+	// now is overridable for tests.
+	now func() time.Time
+}
+
+// NewRateLimiter creates a RateLimiter that applies defaultRate
+// to every endpoint class that isn't explicitly set in perClass.
+func NewRateLimiter(defaultRate Rate, perClass map[EndpointClass]Rate) *RateLimiter {
+	rates := make(map[EndpointClass]Rate, len(perClass))
+	for class, rate := range perClass {
+		rates[class] = rate
+	}
+	return &RateLimiter{
+		defaultRate: defaultRate,
+		rates:       rates,
+		buckets:     make(map[bucketKey]*tokenBucket),
+		sweepAt:     minBucketSweep,
+		now:         time.Now,
+	}
+}
+
+type tokenBucket struct {
+	rate   Rate
+	tokens float64
+	last   time.Time
+
+	// adaptedPerSecond when non-zero overrides rate.PerSecond
+	// until adaptedUntil, as advised by the backend's headers.
+	adaptedPerSecond float64
+	adaptedUntil     time.Time
+
+	pausedUntil time.Time
+}
+
+// minBucketSweep is the fewest buckets that are ever swept.
+const minBucketSweep = 64
+
+// bucketKey is the tenant scope and class that a bucket budgets for.
+type bucketKey struct {
+	tenant string
+	class  EndpointClass
+}
+
+func (rl *RateLimiter) bucketLocked(ctx context.Context, class EndpointClass) *tokenBucket {
+	key := bucketKey{tenant: tenantScope(ctx), class: class}
+	if tb, ok := rl.buckets[key]; ok {
+		return tb
+	}
+	rate, ok := rl.rates[class]
+	if !ok {
+		rate = rl.defaultRate
+	}
+	if rate.Burst < 1 {
+		rate.Burst = 1
+	}
+	now := rl.now()
+	if len(rl.buckets) >= rl.sweepAt {
+		rl.sweepLocked(now)
+	}
+	tb := &tokenBucket{rate: rate, tokens: float64(rate.Burst), last: now}
+	rl.buckets[key] = tb
+	return tb
+}
+
+// sweepLocked drops the buckets that are idle, which a fresh bucket
+// would replace as is, so that a limiter shared by the calls of many
+// tenants doesn't keep a bucket for every tenant it ever saw. Sweeps
+// only happen once the buckets double, which keeps them cheap.
+func (rl *RateLimiter) sweepLocked(now time.Time) {
+	for key, tb := range rl.buckets {
+		if tb.idle(now) {
+			delete(rl.buckets, key)
+		}
+	}
+	rl.sweepAt = 2 * len(rl.buckets)
+	if rl.sweepAt < minBucketSweep {
+		rl.sweepAt = minBucketSweep
+	}
+}
+
+// idle reports whether the bucket is neither paused nor adapted to the
+// backend's headers, and has refilled to its Burst.
+func (tb *tokenBucket) idle(now time.Time) bool {
+	if now.Before(tb.pausedUntil) || now.Before(tb.adaptedUntil) {
+		return false
+	}
+	if tb.rate.PerSecond <= 0 {
+		return true
+	}
+	return tb.tokens+now.Sub(tb.last).Seconds()*tb.rate.PerSecond >= float64(tb.rate.Burst)
+}
+
+func (tb *tokenBucket) perSecond(now time.Time) float64 {
+	if tb.adaptedPerSecond > 0 && now.Before(tb.adaptedUntil) {
+		if tb.rate.PerSecond <= 0 || tb.adaptedPerSecond < tb.rate.PerSecond {
+			return tb.adaptedPerSecond
+		}
+	}
+	return tb.rate.PerSecond
+}
+
+// reserve takes a token, unless the bucket is unlimited, and returns
+// how long the caller must wait before it is allowed to proceed.
+func (tb *tokenBucket) reserve(now time.Time) (wait time.Duration, reserved bool) {
+	if perSecond := tb.perSecond(now); perSecond > 0 {
+		if elapsed := now.Sub(tb.last); elapsed > 0 {
+			tb.tokens += elapsed.Seconds() * perSecond
+			if max := float64(tb.rate.Burst); tb.tokens > max {
+				tb.tokens = max
+			}
+		}
+		tb.last = now
+		if tb.tokens < 1 {
+			wait = time.Duration((1 - tb.tokens) / perSecond * float64(time.Second))
+		}
+		tb.tokens -= 1
+		reserved = true
+	}
+	if pause := tb.pausedUntil.Sub(now); pause > wait {
+		wait = pause
+	}
+	return wait, reserved
+}
+
+// unreserve gives back a token that reserve took.
+func (tb *tokenBucket) unreserve() {
+	if max := float64(tb.rate.Burst); tb.tokens+1 > max {
+		tb.tokens = max
+	} else {
+		tb.tokens += 1
+	}
+}
+
+// Wait blocks until a request in class is allowed to
+// proceed or until ctx is done, whichever happens first.
+func (rl *RateLimiter) Wait(ctx context.Context, class EndpointClass) error {
+	if rl == nil {
+		return nil
+	}
+	rl.mu.Lock()
+	tb := rl.bucketLocked(ctx, class)
+	wait, reserved := tb.reserve(rl.now())
+	rl.mu.Unlock()
+
+	if err := sleepContext(ctx, wait); err != nil {
+		if reserved {
+			// Give back the unused token.
+			rl.mu.Lock()
+			tb.unreserve()
+			rl.mu.Unlock()
+		}
+		return err
+	}
+	return nil
+}
+
+// observe adapts the bucket for class to the rate limit
+// headers that the backend sent back in a response.
+func (rl *RateLimiter) observe(ctx context.Context, class EndpointClass, statusCode int, hdr http.Header) {
+	if rl == nil || hdr == nil {
+		return
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	tb := rl.bucketLocked(ctx, class)
+
+	if statusCode == http.StatusTooManyRequests {
+		if retryAfter, ok := parseRetryAfter(hdr, now); ok {
+			tb.pause(now.Add(retryAfter))
+		}
+	}
+
+	rlh := parseRateLimitHeaders(hdr, now)
+	if !rlh.hasRemaining || rlh.reset.IsZero() || !rlh.reset.After(now) {
+		return
+	}
+	if rlh.remaining <= 0 {
+		tb.pause(rlh.reset)
+		return
+	}
+	// Spread the remaining budget over the rest of the window.
+	tb.adaptedPerSecond = float64(rlh.remaining) / rlh.reset.Sub(now).Seconds()
+	tb.adaptedUntil = rlh.reset
+}
+
+func (tb *tokenBucket) pause(until time.Time) {
+	if until.After(tb.pausedUntil) {
+		tb.pausedUntil = until
+	}
+}
+
+type rateLimitHeaders struct {
+	limit        int64
+	remaining    int64
+	hasRemaining bool
+	reset        time.Time
+}
+
+func parseRateLimitHeaders(hdr http.Header, now time.Time) *rateLimitHeaders {
+	rlh := new(rateLimitHeaders)
+	if value := firstHeader(hdr, "X-RateLimit-Limit", "RateLimit-Limit"); value != "" {
+		rlh.limit, _ = strconv.ParseInt(value, 10, 64)
+	}
+	if value := firstHeader(hdr, "X-RateLimit-Remaining", "RateLimit-Remaining"); value != "" {
+		if remaining, err := strconv.ParseInt(value, 10, 64); err == nil {
+			rlh.remaining, rlh.hasRemaining = remaining, true
+		}
+	}
+	if value := firstHeader(hdr, "X-RateLimit-Reset", "RateLimit-Reset"); value != "" {
+		if reset, err := strconv.ParseInt(value, 10, 64); err == nil {
+			// Large values are absolute Unix timestamps,
+			// small ones are seconds from now.
+			if reset > 1e9 {
+				rlh.reset = time.Unix(reset, 0)
+			} else {
+				rlh.reset = now.Add(time.Duration(reset) * time.Second)
+			}
+		}
+	}
+	return rlh
+}
+
+// SetRateLimiter makes the client wait on rl before every request.
+// Clients without a RateLimiter, including those whose limiter was
+// set to nil, get one of their own that doesn't throttle requests
+// until the backend's rate limit headers or a 429 call for it. Set
+// a limiter, shared by every Client of an account, to stay under
+// the account's rate limit up front.
+func (c *Client) SetRateLimiter(rl *RateLimiter) {
+	c.mu.Lock()
+	c.rateLimiter = rl
+	c.mu.Unlock()
+}
+
+func (c *Client) currentRateLimiter() *RateLimiter {
+	c.mu.RLock()
+	rl := c.rateLimiter
+	c.mu.RUnlock()
+	if rl != nil {
+		return rl
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.rateLimiter == nil {
+		c.rateLimiter = NewRateLimiter(Rate{}, nil)
+	}
+	return c.rateLimiter
+}
@@ -0,0 +1,157 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/orijtech/goshippo/v1"
+)
+
+func TestRateLimiterSharedAcrossGoroutines(t *testing.T) {
+	rl := goshippo.NewRateLimiter(goshippo.Rate{PerSecond: 1000, Burst: 100}, map[goshippo.EndpointClass]goshippo.Rate{
+		goshippo.EndpointParcels: {PerSecond: 20, Burst: 1},
+	})
+
+	ctx := context.Background()
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := rl.Wait(ctx, goshippo.EndpointParcels); err != nil {
+				t.Errorf("wait err: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The first request uses the burst, the other 4 wait 50ms each.
+	if got, want := time.Since(start), 190*time.Millisecond; got < want {
+		t.Errorf("parcels: took %s, expected at least %s", got, want)
+	}
+
+	// Addresses have a separate, larger, budget.
+	start = time.Now()
+	for i := 0; i < 5; i++ {
+		if err := rl.Wait(ctx, goshippo.EndpointAddresses); err != nil {
+			t.Fatalf("#%d: wait err: %v", i, err)
+		}
+	}
+	if got, max := time.Since(start), 50*time.Millisecond; got > max {
+		t.Errorf("addresses: took %s, expected at most %s", got, max)
+	}
+}
+
+func TestRateLimiterWaitCancelled(t *testing.T) {
+	rl := goshippo.NewRateLimiter(goshippo.Rate{PerSecond: 0.01, Burst: 1}, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := rl.Wait(ctx, goshippo.EndpointDefault); err != nil {
+		t.Fatalf("first wait should use the burst: %v", err)
+	}
+	if err := rl.Wait(ctx, goshippo.EndpointDefault); err == nil {
+		t.Fatal("expected the second wait to be cancelled")
+	}
+}
+
+func TestRateLimiterAdaptsToHeaders(t *testing.T) {
+	limiters := [...]*goshippo.RateLimiter{
+		0: goshippo.NewRateLimiter(goshippo.Rate{PerSecond: 1000, Burst: 100}, nil),
+
+		// The default limiter of a Client adapts all the same.
+		1: nil,
+	}
+
+	for i, rl := range limiters {
+		client, err := goshippo.NewClient(token1)
+		if err != nil {
+			t.Fatalf("#%d: client err: %v", i, err)
+		}
+		client.SetRateLimiter(rl)
+
+		be := &backend{route: addressByIDRoute}
+		client.SetHTTPRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			res, err := be.RoundTrip(req)
+			if res != nil {
+				res.Header.Set("X-RateLimit-Limit", "100")
+				res.Header.Set("X-RateLimit-Remaining", "0")
+				res.Header.Set("X-RateLimit-Reset", "1")
+			}
+			return res, err
+		}))
+
+		if _, err := client.AddressByID(addrID1); err != nil {
+			t.Fatalf("#%d: first request err: %v", i, err)
+		}
+		start := time.Now()
+		if _, err := client.AddressByID(addrID1); err != nil {
+			t.Fatalf("#%d: second request err: %v", i, err)
+		}
+		if got, want := time.Since(start), 900*time.Millisecond; got < want {
+			t.Errorf("#%d: second request took %s, expected to be paused for at least %s", i, got, want)
+		}
+	}
+}
+
+func TestRateLimiterDropsIdleTenantBuckets(t *testing.T) {
+	const nTenants = 1000
+	limiter := goshippo.NewRateLimiter(goshippo.Rate{}, nil)
+	client, err := goshippo.New(
+		goshippo.WithAPIKey(token1),
+		goshippo.WithRateLimiter(limiter),
+		goshippo.WithRetryPolicy(&goshippo.RetryPolicy{MaxAttempts: 1}),
+		goshippo.WithHTTPRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("SHIPPO-ACCOUNT-ID") == "acct-busy" {
+				res := makeResp("429 Too Many Requests", http.StatusTooManyRequests)
+				res.Header.Set("Retry-After", "60")
+				return res, nil
+			}
+			return respFromFile("./testdata/parcel-1.json")
+		})),
+	)
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+
+	busy := goshippo.WithTenant(context.Background(), goshippo.Tenant{AccountID: "acct-busy"})
+	if _, err := client.ParcelByIDContext(busy, "adcfdddf8ec64b84ad22772bce3ea37a"); err == nil {
+		t.Fatal("expected a rate limit error")
+	}
+	for i := 0; i < nTenants; i++ {
+		ctx := goshippo.WithTenant(context.Background(), goshippo.Tenant{AccountID: fmt.Sprintf("acct-%d", i)})
+		if _, err := client.ParcelByIDContext(ctx, "adcfdddf8ec64b84ad22772bce3ea37a"); err != nil {
+			t.Fatalf("#%d: parcelByID err: %v", i, err)
+		}
+	}
+	if got, max := goshippo.BucketCount(limiter), 128; got > max {
+		t.Errorf("gotBuckets=%d want at most %d", got, max)
+	}
+
+	// The paused bucket isn't idle, so it must have been kept.
+	ctx, cancel := context.WithTimeout(busy, 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.ParcelByIDContext(ctx, "adcfdddf8ec64b84ad22772bce3ea37a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("gotErr=%v wantErr=%v", err, context.DeadlineExceeded)
+	}
+}
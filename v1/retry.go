@@ -0,0 +1,299 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy configures how the Client retries requests that
+// failed with transient errors. Clients without a RetryPolicy
+// use DefaultRetryPolicy. One whose MaxAttempts is <= 1
+// disables retries.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts
+	// for a request, including the first one.
+	MaxAttempts int `json:"max_attempts"`
+
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration `json:"initial_backoff"`
+
+	// MaxBackoff caps the delay between any two attempts.
+	MaxBackoff time.Duration `json:"max_backoff"`
+
+	// Multiplier is the factor by which the
+	// backoff grows after every attempt.
+	Multiplier float64 `json:"multiplier"`
+
+	// Jitter is the fraction, in the range [0, 1], of each
+	// backoff that is randomized so that many clients
+	// failing at once do not all retry in lockstep.
+	Jitter float64 `json:"jitter"`
+
+	// RetryableStatusCodes are the HTTP status codes that
+	// are considered transient and hence can be retried.
+	RetryableStatusCodes []int `json:"retryable_status_codes"`
+
+	// RetryNetworkErrors if set retries requests that
+	// failed before a response was received e.g because
+	// of a reset connection or a timeout.
+	RetryNetworkErrors bool `json:"retry_network_errors"`
+
+	// RetryNonIdempotent if set allows retrying POST requests
+	// even when it cannot be proven that GoShippo did not
+	// already create the object. Leaving it unset means that
+	// POST requests are only retried if the backend rejected
+	// them with a 429 or if the connection was never established.
+	RetryNonIdempotent bool `json:"retry_non_idempotent"`
+
+	// MaxRetryAfter is the longest Retry-After delay from the
+	// backend that will be honoured. If the backend asks for
+	// a longer wait, the error is returned instead.
+	MaxRetryAfter time.Duration `json:"max_retry_after"`
+}
+
+// DefaultRetryPolicy returns a RetryPolicy that retries
+// rate limited requests, gateway errors and network errors
+// up to 4 times in total, with exponential backoff.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: 250 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		RetryableStatusCodes: []int{
+			http.StatusTooManyRequests,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+		RetryNetworkErrors: true,
+		MaxRetryAfter:      time.Minute,
+	}
+}
+
+// defaultRetryPolicy is shared by all the Clients
+// without a RetryPolicy hence must not be modified.
+var defaultRetryPolicy = DefaultRetryPolicy()
+
+// SetRetryPolicy makes the client retry requests as rp allows.
+// Setting a nil rp restores DefaultRetryPolicy, while retries
+// are disabled with &RetryPolicy{MaxAttempts: 1}.
+func (c *Client) SetRetryPolicy(rp *RetryPolicy) {
+	c.mu.Lock()
+	c.retryPolicy = rp
+	c.mu.Unlock()
+}
+
+func (c *Client) currentRetryPolicy() *RetryPolicy {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.retryPolicy == nil {
+		return defaultRetryPolicy
+	}
+	return c.retryPolicy
+}
+
+func (rp *RetryPolicy) maxAttempts() int {
+	if rp == nil || rp.MaxAttempts < 1 {
+		return 1
+	}
+	return rp.MaxAttempts
+}
+
+// backoff returns the delay to wait before the next attempt
+// given that attempt, which is 1-based, has just failed.
+func (rp *RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := rp.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	backoff := float64(rp.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if rp.MaxBackoff > 0 && backoff > float64(rp.MaxBackoff) {
+		backoff = float64(rp.MaxBackoff)
+	}
+	if jitter := math.Min(math.Max(rp.Jitter, 0), 1); jitter > 0 {
+		backoff -= jitter * backoff * rand.Float64()
+	}
+	return time.Duration(backoff)
+}
+
+func (rp *RetryPolicy) retryableStatus(code int) bool {
+	for _, retryable := range rp.RetryableStatusCodes {
+		if code == retryable {
+			return true
+		}
+	}
+	return false
+}
+
+func idempotentMethod(method string) bool {
+	switch strings.ToUpper(method) {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	default:
+		return false
+	}
+}
+
+// nothingSent reports whether err occurred before the request could
+// have been written to the backend, which makes it safe to retry
+// even for requests that create objects.
+func nothingSent(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// retryDelay reports whether the attempt that produced err, which
+// is 1-based, can be retried and if so, how long to wait beforehand.
+func (rp *RetryPolicy) retryDelay(req *http.Request, attempt int, err error) (time.Duration, bool) {
+	if err == nil || attempt >= rp.maxAttempts() {
+		return 0, false
+	}
+	if !rewindable(req) {
+		// The body was already consumed and can't be replayed.
+		return 0, false
+	}
+	if req.Context().Err() != nil {
+		return 0, false
+	}
+
+	safe := rp.RetryNonIdempotent || idempotentMethod(req.Method)
+
+	if undecodable(err) {
+		// Retrying won't make the body any smaller or valid.
+		return 0, false
+	}
+	if errors.Is(err, ErrCassetteMiss) {
+		// A replayed cassette won't grow the missing interaction.
+		return 0, false
+	}
+
+	ae := new(APIError)
+	if !errors.As(err, &ae) {
+		// No response was received.
+		if !rp.RetryNetworkErrors || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return 0, false
+		}
+		if !safe && !nothingSent(err) {
+			return 0, false
+		}
+		return rp.backoff(attempt), true
+	}
+
+	if !rp.retryableStatus(ae.StatusCode) {
+		return 0, false
+	}
+	// A 429 means that the request was rejected before
+	// being processed hence it is always safe to retry.
+	if !safe && ae.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	delay := rp.backoff(attempt)
+	if retryAfter, ok := parseRetryAfter(ae.Header, time.Now()); ok {
+		if rp.MaxRetryAfter > 0 && retryAfter > rp.MaxRetryAfter {
+			return 0, false
+		}
+		delay = retryAfter
+	}
+	return delay, true
+}
+
+// undecodable reports whether err is a failure to decode
+// a response body that was received in full.
+func undecodable(err error) bool {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, ErrResponseTooLarge), errors.Is(err, errIncompleteBody), errors.Is(err, errTrailingData):
+		return true
+	default:
+		return errors.As(err, &syntaxErr) || errors.As(err, &typeErr)
+	}
+}
+
+// parseRetryAfter parses the Retry-After header which
+// is either a number of seconds or an HTTP date.
+func parseRetryAfter(hdr http.Header, now time.Time) (time.Duration, bool) {
+	value := strings.TrimSpace(hdr.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	at, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if delay := at.Sub(now); delay > 0 {
+		return delay, true
+	}
+	return 0, true
+}
+
+// rewindable reports whether req can be sent once again.
+func rewindable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// rewindRequest returns a copy of req whose body
+// is reset so that it can be sent once again.
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	clone := req.Clone(req.Context())
+	if req.GetBody == nil {
+		return clone, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	clone.Body = body
+	return clone, nil
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
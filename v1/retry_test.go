@@ -0,0 +1,125 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/orijtech/goshippo/v1"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	tests := [...]struct {
+		route        string
+		failures     int
+		failCode     int
+		retryAfter   string
+		policy       *goshippo.RetryPolicy
+		wantErr      bool
+		wantAttempts int32
+	}{
+		0: {
+			// No policy means DefaultRetryPolicy.
+			route: addressByIDRoute, failures: 1, failCode: http.StatusServiceUnavailable,
+			retryAfter: "0", wantAttempts: 2,
+		},
+		1: {
+			route: addressByIDRoute, failures: 2, failCode: http.StatusServiceUnavailable,
+			policy: fastRetryPolicy(), wantAttempts: 3,
+		},
+		2: {
+			// Retries are exhausted.
+			route: addressByIDRoute, failures: 5, failCode: http.StatusBadGateway,
+			policy: fastRetryPolicy(), wantErr: true, wantAttempts: 4,
+		},
+		3: {
+			// A 502 on object creation is not provably safe to retry.
+			route: createParcelRoute, failures: 1, failCode: http.StatusBadGateway,
+			policy: fastRetryPolicy(), wantErr: true, wantAttempts: 1,
+		},
+		4: {
+			// A 429 on object creation was never processed.
+			route: createParcelRoute, failures: 2, failCode: http.StatusTooManyRequests,
+			retryAfter: "0", policy: fastRetryPolicy(), wantAttempts: 3,
+		},
+		5: {
+			// Not found is never retried.
+			route: addressByIDRoute, failures: 1, failCode: http.StatusNotFound,
+			policy: fastRetryPolicy(), wantErr: true, wantAttempts: 1,
+		},
+		6: {
+			// Retry-After longer than the policy allows.
+			route: addressByIDRoute, failures: 1, failCode: http.StatusTooManyRequests,
+			retryAfter: "3600", policy: fastRetryPolicy(), wantErr: true, wantAttempts: 1,
+		},
+		7: {
+			// A single attempt disables retries.
+			route: addressByIDRoute, failures: 1, failCode: http.StatusServiceUnavailable,
+			policy: &goshippo.RetryPolicy{MaxAttempts: 1}, wantErr: true, wantAttempts: 1,
+		},
+	}
+
+	for i, tt := range tests {
+		client, err := goshippo.NewClient(token1)
+		if err != nil {
+			t.Fatalf("#%d: client err: %v", i, err)
+		}
+		client.SetRetryPolicy(tt.policy)
+
+		var attempts int32
+		be := &backend{route: tt.route}
+		client.SetHTTPRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if n := atomic.AddInt32(&attempts, 1); int(n) <= tt.failures {
+				res := makeResp(http.StatusText(tt.failCode), tt.failCode)
+				res.Body = ioutil.NopCloser(strings.NewReader(`{"detail": "transient"}`))
+				if tt.retryAfter != "" {
+					res.Header.Set("Retry-After", tt.retryAfter)
+				}
+				return res, nil
+			}
+			return be.RoundTrip(req)
+		}))
+
+		switch tt.route {
+		case createParcelRoute:
+			_, err = client.CreateParcel(&goshippo.Parcel{
+				Length: 10, Width: 10, Height: 10, Weight: 1,
+				DistanceUnit: goshippo.DistanceInch,
+				MassUnit:     goshippo.MassPound,
+			})
+		default:
+			_, err = client.AddressByID(addrID1)
+		}
+
+		if gotErr := err != nil; gotErr != tt.wantErr {
+			t.Errorf("#%d: gotErr=%v wantErr=%v", i, err, tt.wantErr)
+		}
+		if got, want := atomic.LoadInt32(&attempts), tt.wantAttempts; got != want {
+			t.Errorf("#%d: gotAttempts=%d wantAttempts=%d", i, got, want)
+		}
+	}
+}
+
+func fastRetryPolicy() *goshippo.RetryPolicy {
+	rp := goshippo.DefaultRetryPolicy()
+	rp.InitialBackoff = time.Millisecond
+	rp.MaxBackoff = 5 * time.Millisecond
+	return rp
+}
@@ -0,0 +1,287 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyncMark is the high-water mark of a synced list: the latest
+// object_created and object_updated times that were stored.
+// UpdatedAt is only advanced by syncs that walked the whole list,
+// since only those are sure to have seen every update.
+type SyncMark struct {
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// SyncedAt is when the mark was last saved.
+	SyncedAt time.Time `json:"synced_at"`
+}
+
+// Store is where synced objects and the marks of their lists
+// are persisted. Implementations must be safe for concurrent use.
+type Store interface {
+	// Mark returns the mark saved for class,
+	// or nil if class was never synced.
+	Mark(class EndpointClass) (*SyncMark, error)
+
+	// SaveMark saves the mark of class.
+	SaveMark(class EndpointClass, mark *SyncMark) error
+
+	// Put creates or replaces the object with id.
+	Put(class EndpointClass, id string, object interface{}) error
+}
+
+type SyncResult struct {
+	Class EndpointClass `json:"class"`
+
+	// Stored is the number of new or updated objects stored.
+	Stored uint64 `json:"stored"`
+
+	// Pages is the number of pages that were fetched.
+	Pages uint64 `json:"pages"`
+
+	// Full reports whether the whole list was walked, storing
+	// every object updated since the mark wherever it was.
+	Full bool `json:"full"`
+
+	Mark *SyncMark `json:"mark"`
+}
+
+var errNilStore = errors.New("expecting a non-nil store")
+
+type fullSyncCtxKey struct{}
+
+// WithFullSync returns a context that makes syncs walk the whole
+// list, rather than stop at the pages of objects that predate the
+// mark, to also store the objects updated deeper in the list.
+func WithFullSync(ctx context.Context) context.Context {
+	return context.WithValue(ctx, fullSyncCtxKey{}, true)
+}
+
+func fullSyncRequested(ctx context.Context) bool {
+	full, _ := ctx.Value(fullSyncCtxKey{}).(bool)
+	return full
+}
+
+// SyncAddresses stores the addresses created or updated since the
+// last sync in store. See SyncParcels for how objects are fetched.
+func (c *Client) SyncAddresses(ctx context.Context, store Store) (*SyncResult, error) {
+	pager, err := c.NewAddressPager(&ListRequest{ThrottleDurationMs: NoThrottle})
+	if err != nil {
+		return nil, err
+	}
+	return syncObjects(ctx, store, EndpointAddresses, pager, func(addr *Address) (string, *time.Time, *time.Time) {
+		return addr.ID, addr.CreatedAt, addr.UpdatedAt
+	})
+}
+
+// SyncParcels stores the parcels created or updated since the last
+// sync in store. Lists are ordered from the newest object, so paging
+// stops at the first page whose objects all precede the mark. Objects
+// updated after the mark are stored if they are on the pages walked;
+// those further down the list are only stored by full syncs, see
+// WithFullSync, which should be run periodically. The mark is only
+// saved once a sync completes, so a failed sync can simply be retried.
+func (c *Client) SyncParcels(ctx context.Context, store Store) (*SyncResult, error) {
+	pager, err := c.NewParcelPager(&ListRequest{ThrottleDurationMs: NoThrottle})
+	if err != nil {
+		return nil, err
+	}
+	return syncObjects(ctx, store, EndpointParcels, pager, func(parcel *Parcel) (string, *time.Time, *time.Time) {
+		return parcel.ID, parcel.CreatedAt, parcel.UpdatedAt
+	})
+}
+
+func syncObjects[T any](ctx context.Context, store Store, class EndpointClass, pager *Pager[T], stamps func(T) (string, *time.Time, *time.Time)) (*SyncResult, error) {
+	if store == nil {
+		return nil, errNilStore
+	}
+	prevMark, err := store.Mark(class)
+	if err != nil {
+		return nil, err
+	}
+	if prevMark == nil {
+		prevMark = new(SyncMark)
+	}
+
+	mark := &SyncMark{CreatedAt: prevMark.CreatedAt, UpdatedAt: prevMark.UpdatedAt}
+	res := &SyncResult{Class: class, Mark: mark}
+	// The latest update seen, which only becomes the
+	// mark if every page of the list gets walked.
+	updatedAtMark := prevMark.UpdatedAt
+	fullSync, walkedAll := fullSyncRequested(ctx), true
+	for page, err := range pager.Pages(ctx) {
+		if err != nil {
+			return res, err
+		}
+		res.Pages += 1
+
+		allBeforeMark := true
+		for _, obj := range page.Items {
+			id, createdAt, updatedAt := stamps(obj)
+			if id == "" {
+				continue
+			}
+			isNew := createdAt == nil || !createdAt.Before(prevMark.CreatedAt)
+			isUpdated := updatedAt != nil && updatedAt.After(prevMark.UpdatedAt)
+			if isNew {
+				allBeforeMark = false
+			}
+			if !isNew && !isUpdated {
+				continue
+			}
+
+			if err := store.Put(class, id, obj); err != nil {
+				return res, err
+			}
+			res.Stored += 1
+			if createdAt != nil && createdAt.After(mark.CreatedAt) {
+				mark.CreatedAt = *createdAt
+			}
+			if updatedAt != nil && updatedAt.After(updatedAtMark) {
+				updatedAtMark = *updatedAt
+			}
+		}
+
+		if allBeforeMark && !prevMark.CreatedAt.IsZero() && !fullSync && page.NextToken != "" {
+			walkedAll = false
+			break
+		}
+	}
+	if walkedAll {
+		mark.UpdatedAt = updatedAtMark
+	}
+	res.Full = walkedAll
+
+	mark.SyncedAt = time.Now().UTC()
+	if err := store.SaveMark(class, mark); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// FileStore is a Store that keeps every object as a JSON file
+// named <dir>/<class>/<id>.json and the marks in <dir>/marks.json.
+type FileStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+var _ Store = (*FileStore)(nil)
+
+var errInvalidObjectID = errors.New("object ID cannot be used as a file name")
+
+// NewFileStore creates, if need be, and uses the directory dir.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (fs *FileStore) marksPath() string {
+	return filepath.Join(fs.dir, "marks.json")
+}
+
+func (fs *FileStore) loadMarks() (map[EndpointClass]*SyncMark, error) {
+	marks := make(map[EndpointClass]*SyncMark)
+	blob, err := os.ReadFile(fs.marksPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return marks, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(blob, &marks); err != nil {
+		return nil, err
+	}
+	return marks, nil
+}
+
+func (fs *FileStore) Mark(class EndpointClass) (*SyncMark, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	marks, err := fs.loadMarks()
+	if err != nil {
+		return nil, err
+	}
+	return marks[class], nil
+}
+
+func (fs *FileStore) SaveMark(class EndpointClass, mark *SyncMark) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	marks, err := fs.loadMarks()
+	if err != nil {
+		return err
+	}
+	marks[class] = mark
+	blob, err := json.MarshalIndent(marks, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(fs.marksPath(), blob)
+}
+
+func (fs *FileStore) Put(class EndpointClass, id string, object interface{}) error {
+	if id == "" || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return errInvalidObjectID
+	}
+	blob, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+
+	classDir := filepath.Join(fs.dir, string(class))
+	if err := os.MkdirAll(classDir, 0700); err != nil {
+		return err
+	}
+	return writeFileAtomically(filepath.Join(classDir, id+".json"), blob)
+}
+
+// writeFileAtomically writes blob to a temporary file that then replaces
+// path, so that a crash never leaves a partially written file behind.
+func writeFileAtomically(path string, blob []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	if _, err := f.Write(blob); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,223 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/orijtech/goshippo/v1"
+)
+
+// addressList is a stand-in backend for the listing of its
+// addresses, which are ordered from the newest like the backend does.
+type addressList struct {
+	mu        sync.Mutex
+	addresses []*goshippo.Address
+	fetches   int
+}
+
+func (al *addressList) server(limit int) *httptest.Server {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		al.mu.Lock()
+		defer al.mu.Unlock()
+		al.fetches += 1
+
+		page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+		start, end := (page-1)*limit, page*limit
+		if end > len(al.addresses) {
+			end = len(al.addresses)
+		}
+		wrap := map[string]interface{}{
+			"count":   len(al.addresses),
+			"results": al.addresses[start:end],
+		}
+		if end < len(al.addresses) {
+			wrap["next"] = fmt.Sprintf("%s/addresses/?limit=%d&page=%d", srv.URL, limit, page+1)
+		}
+		json.NewEncoder(rw).Encode(wrap)
+	}))
+	return srv
+}
+
+func syncStamp(minutes int) *time.Time {
+	t := time.Date(2017, 6, 29, 8, 0, 0, 0, time.UTC).Add(time.Duration(minutes) * time.Minute)
+	return &t
+}
+
+func TestSyncAddresses(t *testing.T) {
+	stamp := syncStamp
+	al := &addressList{addresses: []*goshippo.Address{
+		{ID: "addr-3", CreatedAt: stamp(3), UpdatedAt: stamp(3)},
+		{ID: "addr-2", CreatedAt: stamp(2), UpdatedAt: stamp(2)},
+		{ID: "addr-1", CreatedAt: stamp(1), UpdatedAt: stamp(1)},
+	}}
+	srv := al.server(2)
+	defer srv.Close()
+
+	client, err := goshippo.New(goshippo.WithAPIKey(token1), goshippo.WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	dir := t.TempDir()
+	store, err := goshippo.NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("fileStore err: %v", err)
+	}
+
+	res, err := client.SyncAddresses(context.Background(), store)
+	if err != nil {
+		t.Fatalf("first sync err: %v", err)
+	}
+	if res.Stored != 3 || res.Pages != 2 {
+		t.Errorf("first sync: gotStored=%d gotPages=%d wantStored=3 wantPages=2", res.Stored, res.Pages)
+	}
+	if got, want := res.Mark.CreatedAt, *stamp(3); !got.Equal(want) {
+		t.Errorf("gotMark=%s wantMark=%s", got, want)
+	}
+
+	// A new address and an update of one on the first page.
+	al.mu.Lock()
+	al.addresses[0].UpdatedAt = stamp(5)
+	al.addresses[0].Metadata = "Updated"
+	al.addresses = append([]*goshippo.Address{{ID: "addr-4", CreatedAt: stamp(4), UpdatedAt: stamp(4)}}, al.addresses...)
+	al.fetches = 0
+	al.mu.Unlock()
+
+	// The mark must survive reopening the store.
+	store, err = goshippo.NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("reopened fileStore err: %v", err)
+	}
+	res, err = client.SyncAddresses(context.Background(), store)
+	if err != nil {
+		t.Fatalf("second sync err: %v", err)
+	}
+	if res.Stored != 2 {
+		t.Errorf("second sync: gotStored=%d wantStored=2", res.Stored)
+	}
+	// Page 2 holds addresses that were all created before the mark.
+	if res.Pages != 2 || al.fetches != 2 {
+		t.Errorf("second sync: gotPages=%d gotFetches=%d want 2", res.Pages, al.fetches)
+	}
+	if got, want := res.Mark.UpdatedAt, *stamp(5); !got.Equal(want) {
+		t.Errorf("gotUpdatedMark=%s wantUpdatedMark=%s", got, want)
+	}
+
+	blob, err := os.ReadFile(filepath.Join(dir, "addresses", "addr-3.json"))
+	if err != nil {
+		t.Fatalf("reading stored address: %v", err)
+	}
+	stored := new(goshippo.Address)
+	if err := json.Unmarshal(blob, stored); err != nil {
+		t.Fatalf("unmarshal stored address: %v", err)
+	}
+	if stored.Metadata != "Updated" {
+		t.Errorf("gotMetadata=%q wantMetadata=%q", stored.Metadata, "Updated")
+	}
+
+	mark, err := store.Mark(goshippo.EndpointAddresses)
+	if err != nil || mark == nil {
+		t.Fatalf("mark err=%v mark=%v", err, mark)
+	}
+	if got, want := mark.CreatedAt, *stamp(4); !got.Equal(want) {
+		t.Errorf("gotSavedMark=%s wantSavedMark=%s", got, want)
+	}
+}
+
+func TestSyncUpdatesDeeperInTheList(t *testing.T) {
+	stamp := syncStamp
+	al := new(addressList)
+	for i := 6; i >= 1; i-- {
+		al.addresses = append(al.addresses, &goshippo.Address{ID: fmt.Sprintf("addr-%d", i), CreatedAt: stamp(i), UpdatedAt: stamp(i)})
+	}
+	srv := al.server(2)
+	defer srv.Close()
+
+	client, err := goshippo.New(goshippo.WithAPIKey(token1), goshippo.WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	store, err := goshippo.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("fileStore err: %v", err)
+	}
+	if _, err := client.SyncAddresses(context.Background(), store); err != nil {
+		t.Fatalf("first sync err: %v", err)
+	}
+
+	// A new address, and an update of the oldest one, on the last page.
+	al.mu.Lock()
+	al.addresses[len(al.addresses)-1].UpdatedAt = stamp(8)
+	al.addresses = append([]*goshippo.Address{{ID: "addr-7", CreatedAt: stamp(7), UpdatedAt: stamp(7)}}, al.addresses...)
+	al.mu.Unlock()
+
+	tests := [...]struct {
+		ctx         context.Context
+		wantStored  uint64
+		wantPages   uint64
+		wantFull    bool
+		wantUpdated *time.Time
+	}{
+		// Objects created at the mark are stored again, in case
+		// others were created in the same instant. The update wasn't
+		// seen, so the mark must not claim it was.
+		0: {ctx: context.Background(), wantStored: 2, wantPages: 2, wantUpdated: stamp(6)},
+		1: {ctx: goshippo.WithFullSync(context.Background()), wantStored: 2, wantPages: 4, wantFull: true, wantUpdated: stamp(8)},
+		2: {ctx: context.Background(), wantStored: 1, wantPages: 2, wantUpdated: stamp(8)},
+	}
+
+	for i, tt := range tests {
+		res, err := client.SyncAddresses(tt.ctx, store)
+		if err != nil {
+			t.Errorf("#%d: sync err: %v", i, err)
+			continue
+		}
+		if res.Stored != tt.wantStored || res.Pages != tt.wantPages || res.Full != tt.wantFull {
+			t.Errorf("#%d: got (stored=%d pages=%d full=%v) want (stored=%d pages=%d full=%v)",
+				i, res.Stored, res.Pages, res.Full, tt.wantStored, tt.wantPages, tt.wantFull)
+		}
+		mark, err := store.Mark(goshippo.EndpointAddresses)
+		if err != nil || mark == nil {
+			t.Errorf("#%d: mark err=%v mark=%v", i, err, mark)
+			continue
+		}
+		if !mark.UpdatedAt.Equal(*tt.wantUpdated) {
+			t.Errorf("#%d: gotUpdatedMark=%s wantUpdatedMark=%s", i, mark.UpdatedAt, tt.wantUpdated)
+		}
+	}
+}
+
+func TestFileStoreRejectsBadIDs(t *testing.T) {
+	store, err := goshippo.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("fileStore err: %v", err)
+	}
+	for i, id := range []string{"", ".", "..", "../escape", `a\b`} {
+		if err := store.Put(goshippo.EndpointParcels, id, &goshippo.Parcel{ID: id}); err == nil {
+			t.Errorf("#%d: expected an error for id %q", i, id)
+		}
+	}
+}
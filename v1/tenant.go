@@ -0,0 +1,93 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/orijtech/otils"
+)
+
+// Tenant is the account, e.g a merchant of a platform, that
+// calls are made on behalf of. Passing it in the context of the
+// ...Context methods with WithTenant lets one Client, and its
+// pooled connections, serve every tenant.
+type Tenant struct {
+	// ID identifies the tenant in spans and logs.
+	// It defaults to AccountID if blank.
+	ID string
+
+	// APIKey, if set, authenticates the call in
+	// place of the key that the Client was set up with.
+	APIKey string
+
+	// AccessToken, if set, is the OAuth access token that a
+	// merchant granted a Shippo app, which then authenticates
+	// the call as a Bearer token. It takes precedence over APIKey.
+	AccessToken string
+
+	// AccountID, if set, is sent in the SHIPPO-ACCOUNT-ID header
+	// to act on behalf of a managed account of a Shippo Platform.
+	AccountID string
+}
+
+const headerShippoAccountID = "SHIPPO-ACCOUNT-ID"
+
+type tenantCtxKey struct{}
+
+// WithTenant returns a context that makes the calls it is passed to
+// act on behalf of tenant.
+func WithTenant(ctx context.Context, tenant Tenant) context.Context {
+	tenant.ID = strings.TrimSpace(tenant.ID)
+	tenant.APIKey = strings.TrimSpace(tenant.APIKey)
+	tenant.AccessToken = strings.TrimSpace(tenant.AccessToken)
+	tenant.AccountID = strings.TrimSpace(tenant.AccountID)
+	return context.WithValue(ctx, tenantCtxKey{}, tenant)
+}
+
+// TenantFromContext returns the Tenant that ctx was armed with by WithTenant.
+func TenantFromContext(ctx context.Context) (Tenant, bool) {
+	tenant, ok := ctx.Value(tenantCtxKey{}).(Tenant)
+	return tenant, ok
+}
+
+// tenantID returns the ID that the tenant of ctx is tagged
+// with in spans and logs, or "" if there is no tenant.
+func tenantID(ctx context.Context) string {
+	tenant, _ := TenantFromContext(ctx)
+	if tenant.ID != "" {
+		return tenant.ID
+	}
+	return tenant.AccountID
+}
+
+// tenantScope returns what keeps the state of the tenant of ctx, such
+// as its journal entries and rate limit budgets, apart from that of the
+// other tenants: its ID or else a digest of its credentials. It is ""
+// for calls made without a tenant.
+func tenantScope(ctx context.Context) string {
+	if id := tenantID(ctx); id != "" {
+		return "id:" + id
+	}
+	tenant, _ := TenantFromContext(ctx)
+	if credential := otils.FirstNonEmptyString(tenant.AccessToken, tenant.APIKey); credential != "" {
+		sum := sha256.Sum256([]byte(credential))
+		return "key:" + hex.EncodeToString(sum[:8])
+	}
+	return ""
+}
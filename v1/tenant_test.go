@@ -0,0 +1,225 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/orijtech/goshippo/v1"
+)
+
+func TestTenantOverride(t *testing.T) {
+	var mu sync.Mutex
+	var gotHeaders http.Header
+	rt := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		gotHeaders = req.Header.Clone()
+		mu.Unlock()
+		return (&backend{route: addressByIDRoute}).RoundTrip(req)
+	})
+
+	logBuf := new(bytes.Buffer)
+	client, err := goshippo.New(
+		goshippo.WithAPIKey(token1),
+		goshippo.WithHTTPRoundTripper(rt),
+		goshippo.WithLogger(log.New(logBuf, "", 0)),
+		goshippo.WithLogLevel(goshippo.LogRequests),
+	)
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+
+	tests := [...]struct {
+		tenant        *goshippo.Tenant
+		wantAuth      string
+		wantAccountID string
+		wantLogTag    string
+	}{
+		0: {wantAuth: "ShippoToken " + token1},
+		1: {
+			tenant:   &goshippo.Tenant{APIKey: token2, AccountID: "acct-1"},
+			wantAuth: "ShippoToken " + token2, wantAccountID: "acct-1", wantLogTag: `tenant="acct-1"`,
+		},
+		2: {
+			tenant:   &goshippo.Tenant{ID: "merchant-7", AccountID: " acct-2 "},
+			wantAuth: "ShippoToken " + token1, wantAccountID: "acct-2", wantLogTag: `tenant="merchant-7"`,
+		},
+		3: {
+			tenant:   &goshippo.Tenant{ID: "merchant-8"},
+			wantAuth: "ShippoToken " + token1, wantLogTag: `tenant="merchant-8"`,
+		},
+	}
+
+	for i, tt := range tests {
+		logBuf.Reset()
+		ctx := context.Background()
+		if tt.tenant != nil {
+			ctx = goshippo.WithTenant(ctx, *tt.tenant)
+		}
+		if _, err := client.AddressByIDContext(ctx, addrID1); err != nil {
+			t.Errorf("#%d: addressByID err: %v", i, err)
+			continue
+		}
+
+		mu.Lock()
+		auth, accountID := gotHeaders.Get("Authorization"), gotHeaders.Get("SHIPPO-ACCOUNT-ID")
+		mu.Unlock()
+		if auth != tt.wantAuth {
+			t.Errorf("#%d: gotAuth=%q wantAuth=%q", i, auth, tt.wantAuth)
+		}
+		if accountID != tt.wantAccountID {
+			t.Errorf("#%d: gotAccountID=%q wantAccountID=%q", i, accountID, tt.wantAccountID)
+		}
+
+		logs := logBuf.String()
+		if tt.wantLogTag == "" && strings.Contains(logs, "tenant=") {
+			t.Errorf("#%d: unexpected tenant in logs:\n%s", i, logs)
+		}
+		if got := strings.Count(logs, tt.wantLogTag); tt.wantLogTag != "" && got != 2 {
+			t.Errorf("#%d: expected %q on both log lines:\n%s", i, tt.wantLogTag, logs)
+		}
+	}
+}
+
+func TestTenantModeChecks(t *testing.T) {
+	client, err := goshippo.New(
+		goshippo.WithAPIKey("shippo_live_platform"),
+		goshippo.WithHTTPRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return makeResp("500 Internal Server Error", http.StatusInternalServerError), nil
+		})),
+	)
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	client.SetLivePurchaseGuard(true)
+
+	tx := &goshippo.Transaction{Rate: "ee81fab0372e419ab52245c8952ccaeb"}
+	if _, err := client.CreateTransaction(tx); err != goshippo.ErrLivePurchaseNotArmed {
+		t.Errorf("gotErr=%v wantErr=%v", err, goshippo.ErrLivePurchaseNotArmed)
+	}
+
+	// The guard goes by the key of the tenant, which is in test mode.
+	ctx := goshippo.WithTenant(context.Background(), goshippo.Tenant{APIKey: "shippo_test_merchant"})
+	if _, err := client.CreateTransactionContext(ctx, tx); err == goshippo.ErrLivePurchaseNotArmed {
+		t.Errorf("unexpected %v for a tenant in test mode", err)
+	}
+}
+
+func TestTenantIdempotencyKeys(t *testing.T) {
+	var posts int
+	client, err := goshippo.New(
+		goshippo.WithAPIKey(token1),
+		goshippo.WithJournal(goshippo.NewMemoryJournal()),
+		goshippo.WithHTTPRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			account := req.Header.Get("SHIPPO-ACCOUNT-ID")
+			if req.Method == "POST" {
+				posts += 1
+				account += "-new"
+			}
+			res := makeResp("200 OK", http.StatusOK)
+			res.Body = ioutil.NopCloser(strings.NewReader(fmt.Sprintf(`{"object_id": %q}`, "parcel-of-"+account)))
+			return res, nil
+		})),
+	)
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	parcel := &goshippo.Parcel{
+		Length: 5, Width: 5, Height: 5, Weight: 2,
+		DistanceUnit: goshippo.DistanceInch, MassUnit: goshippo.MassPound,
+	}
+
+	// Both merchants derive their key from an order number of 1001.
+	tests := [...]struct {
+		accountID string
+		wantID    string
+		wantPosts int
+	}{
+		0: {accountID: "acct-a", wantID: "parcel-of-acct-a-new", wantPosts: 1},
+		1: {accountID: "acct-b", wantID: "parcel-of-acct-b-new", wantPosts: 2},
+		// Replays return the tenant's own parcel.
+		2: {accountID: "acct-a", wantID: "parcel-of-acct-a", wantPosts: 2},
+		3: {accountID: "acct-b", wantID: "parcel-of-acct-b", wantPosts: 2},
+	}
+
+	for i, tt := range tests {
+		ctx := goshippo.WithTenant(context.Background(), goshippo.Tenant{AccountID: tt.accountID})
+		ctx = goshippo.WithIdempotencyKey(ctx, "order-1001")
+		got, err := client.CreateParcelContext(ctx, parcel)
+		if err != nil {
+			t.Errorf("#%d: createParcel err: %v", i, err)
+			continue
+		}
+		// Replays fetch the journaled parcel by its ID, which the fake
+		// backend answers with the parcel of the account that asks.
+		if got.ID != tt.wantID {
+			t.Errorf("#%d: gotID=%q wantID=%q", i, got.ID, tt.wantID)
+		}
+		if posts != tt.wantPosts {
+			t.Errorf("#%d: gotPosts=%d wantPosts=%d", i, posts, tt.wantPosts)
+		}
+	}
+}
+
+func TestTenantRateLimits(t *testing.T) {
+	client, err := goshippo.New(
+		goshippo.WithAPIKey(token1),
+		goshippo.WithRetryPolicy(&goshippo.RetryPolicy{MaxAttempts: 1}),
+		goshippo.WithHTTPRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("SHIPPO-ACCOUNT-ID") == "acct-busy" {
+				res := makeResp("429 Too Many Requests", http.StatusTooManyRequests)
+				res.Header.Set("Retry-After", "60")
+				return res, nil
+			}
+			return respFromFile("./testdata/parcel-1.json")
+		})),
+	)
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+
+	busy := goshippo.WithTenant(context.Background(), goshippo.Tenant{AccountID: "acct-busy"})
+	if _, err := client.ParcelByIDContext(busy, "adcfdddf8ec64b84ad22772bce3ea37a"); err == nil {
+		t.Fatal("expected a rate limit error")
+	}
+
+	// The 429 of one tenant mustn't pause the others.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	idle := goshippo.WithTenant(ctx, goshippo.Tenant{AccountID: "acct-idle"})
+	if _, err := client.ParcelByIDContext(idle, "adcfdddf8ec64b84ad22772bce3ea37a"); err != nil {
+		t.Errorf("idle tenant err: %v", err)
+	}
+	if _, err := client.ParcelByIDContext(ctx, "adcfdddf8ec64b84ad22772bce3ea37a"); err != nil {
+		t.Errorf("no tenant err: %v", err)
+	}
+
+	// While the busy tenant waits out its Retry-After.
+	busy, cancel = context.WithTimeout(busy, 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.ParcelByIDContext(busy, "adcfdddf8ec64b84ad22772bce3ea37a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("gotErr=%v wantErr=%v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenSource supplies the API key that the Client
+// authenticates with. It is consulted on every request,
+// so that keys can be rotated without recreating the Client.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// TokenRefresher is implemented by TokenSources that cache the
+// API key. When the backend rejects a key with a 401, the Client
+// invokes Refresh and, if that yields a different key, retries
+// the request once with it.
+type TokenRefresher interface {
+	Refresh(ctx context.Context) error
+}
+
+var (
+	errBlankToken     = errors.New("expecting a non-blank API key")
+	errNilTokenSource = errors.New("expecting a non-nil TokenSource")
+)
+
+type staticTokenSource string
+
+// StaticTokenSource returns a TokenSource that always supplies key.
+func StaticTokenSource(key string) TokenSource {
+	return staticTokenSource(strings.TrimSpace(key))
+}
+
+func (sts staticTokenSource) Token(ctx context.Context) (string, error) {
+	if sts == "" {
+		return "", errBlankToken
+	}
+	return string(sts), nil
+}
+
+type envTokenSource string
+
+// EnvTokenSource returns a TokenSource that reads the API key from
+// the environment variable name, GOSHIPPO_TOKEN if name is blank,
+// on every request.
+func EnvTokenSource(name string) TokenSource {
+	if name == "" {
+		name = envGoShippoToken
+	}
+	return envTokenSource(name)
+}
+
+func (ets envTokenSource) Token(ctx context.Context) (string, error) {
+	token := strings.TrimSpace(os.Getenv(string(ets)))
+	if token == "" {
+		return "", fmt.Errorf("did not find %q in your environment", string(ets))
+	}
+	return token, nil
+}
+
+const defaultTokenPollInterval = time.Second
+
+// FileTokenSource supplies the API key stored in a file, such as
+// a mounted secret, and picks up the new key once the file changes.
+// The file is checked for changes at most once per poll interval
+// and whenever the backend rejects the key.
+type FileTokenSource struct {
+	path         string
+	pollInterval time.Duration
+
+	mu        sync.Mutex
+	token     string
+	modTime   time.Time
+	size      int64
+	checkedAt time.Time
+}
+
+var _ TokenRefresher = (*FileTokenSource)(nil)
+
+// NewFileTokenSource returns a FileTokenSource for the file at path,
+// which must exist and hold a non-blank key. A pollInterval <= 0
+// means that the file is checked for changes at most every second.
+func NewFileTokenSource(path string, pollInterval time.Duration) (*FileTokenSource, error) {
+	if pollInterval <= 0 {
+		pollInterval = defaultTokenPollInterval
+	}
+	fts := &FileTokenSource{path: path, pollInterval: pollInterval}
+	if err := fts.load(); err != nil {
+		return nil, err
+	}
+	return fts, nil
+}
+
+func (fts *FileTokenSource) Token(ctx context.Context) (string, error) {
+	fts.mu.Lock()
+	defer fts.mu.Unlock()
+
+	if now := time.Now(); now.Sub(fts.checkedAt) >= fts.pollInterval {
+		fts.checkedAt = now
+		fi, err := os.Stat(fts.path)
+		// While a key is being rotated e.g by renaming a new file into
+		// place, the file can briefly be missing so keep the old key.
+		if err == nil && (!fi.ModTime().Equal(fts.modTime) || fi.Size() != fts.size) {
+			_ = fts.load()
+		}
+	}
+	return fts.token, nil
+}
+
+// Refresh rereads the file, whether or not it seems to have changed.
+func (fts *FileTokenSource) Refresh(ctx context.Context) error {
+	fts.mu.Lock()
+	defer fts.mu.Unlock()
+
+	return fts.load()
+}
+
+// load reads the key from the file. It must be invoked with fts.mu held.
+func (fts *FileTokenSource) load() error {
+	f, err := os.Open(fts.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	blob, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	token := strings.TrimSpace(string(blob))
+	if token == "" {
+		return fmt.Errorf("%q: %w", fts.path, errBlankToken)
+	}
+	fts.token = token
+	fts.modTime, fts.size = fi.ModTime(), fi.Size()
+	fts.checkedAt = time.Now()
+	return nil
+}
+
+// SetTokenSource makes the client authenticate every request with
+// the API key supplied by ts, in place of the key it was created with.
+func (c *Client) SetTokenSource(ts TokenSource) error {
+	return c.setTokenSource(ts, schemeShippoToken)
+}
+
+func (c *Client) setTokenSource(ts TokenSource, scheme string) error {
+	if ts == nil {
+		return errNilTokenSource
+	}
+	c.mu.Lock()
+	c.tokenSource = ts
+	c.authScheme = scheme
+	c.mu.Unlock()
+	return nil
+}
+
+const (
+	schemeShippoToken = "ShippoToken"
+	schemeBearer      = "Bearer"
+)
+
+// token returns the Authorization scheme and the API key or
+// OAuth access token to authenticate a request with, those
+// of the Tenant in ctx if it has any.
+func (c *Client) token(ctx context.Context) (scheme, token string, err error) {
+	tenant, _ := TenantFromContext(ctx)
+	switch {
+	case tenant.AccessToken != "":
+		return schemeBearer, tenant.AccessToken, nil
+	case tenant.APIKey != "":
+		return schemeShippoToken, tenant.APIKey, nil
+	}
+
+	c.mu.RLock()
+	ts, key, scheme := c.tokenSource, c.__apiKey, c.authScheme
+	c.mu.RUnlock()
+
+	if scheme == "" {
+		scheme = schemeShippoToken
+	}
+	if ts == nil {
+		return scheme, key, nil
+	}
+	token, err = ts.Token(ctx)
+	return scheme, token, err
+}
+
+// refreshToken reports whether, after refreshing its TokenSource, the
+// client has an API key or access token that differs from stale, the
+// one that the backend rejected.
+func (c *Client) refreshToken(ctx context.Context, stale string) bool {
+	if tenant, _ := TenantFromContext(ctx); tenant.APIKey != "" || tenant.AccessToken != "" {
+		// The keys of tenants are not ours to refresh.
+		return false
+	}
+
+	c.mu.RLock()
+	ts := c.tokenSource
+	c.mu.RUnlock()
+
+	if refresher, ok := ts.(TokenRefresher); ok {
+		if err := refresher.Refresh(ctx); err != nil {
+			c.logf("goshippo: refreshing the credentials failed: %v", err)
+			return false
+		}
+	}
+	_, token, err := c.token(ctx)
+	return err == nil && token != stale
+}
+
+func isUnauthorized(err error) bool {
+	ae := new(APIError)
+	return errors.As(err, &ae) && ae.StatusCode == http.StatusUnauthorized
+}
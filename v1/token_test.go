@@ -0,0 +1,273 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/orijtech/goshippo/v1"
+)
+
+// keyCheckingTransport serves parcel-1.json to requests
+// authenticated with the current key and 401s the others.
+type keyCheckingTransport struct {
+	mu      sync.Mutex
+	key     string
+	gotKeys []string
+}
+
+func (kct *keyCheckingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	kct.mu.Lock()
+	defer kct.mu.Unlock()
+
+	got := req.Header.Get("Authorization")
+	kct.gotKeys = append(kct.gotKeys, got)
+	if got != "ShippoToken "+kct.key {
+		return makeResp("401 Unauthorized", http.StatusUnauthorized), nil
+	}
+	return respFromFile("./testdata/parcel-1.json")
+}
+
+func (kct *keyCheckingTransport) rotate(key string) {
+	kct.mu.Lock()
+	kct.key = key
+	kct.gotKeys = nil
+	kct.mu.Unlock()
+}
+
+func (kct *keyCheckingTransport) keys() []string {
+	kct.mu.Lock()
+	defer kct.mu.Unlock()
+	return append([]string(nil), kct.gotKeys...)
+}
+
+func writeKey(t *testing.T, path, key string) {
+	if err := os.WriteFile(path, []byte(key+"\n"), 0600); err != nil {
+		t.Fatalf("writeFile err: %v", err)
+	}
+}
+
+func TestFileTokenSourceRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shippo-key")
+	writeKey(t, path, token1)
+
+	// The poll interval is long enough for
+	// only a 401 to pick up the new key.
+	fts, err := goshippo.NewFileTokenSource(path, time.Hour)
+	if err != nil {
+		t.Fatalf("newFileTokenSource err: %v", err)
+	}
+	kct := &keyCheckingTransport{key: token1}
+	client, err := goshippo.New(goshippo.WithTokenSource(fts), goshippo.WithHTTPRoundTripper(kct))
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+
+	const parcelID = "adcfdddf8ec64b84ad22772bce3ea37a"
+	if _, err := client.ParcelByID(parcelID); err != nil {
+		t.Fatalf("parcelByID err: %v", err)
+	}
+
+	writeKey(t, path, token2)
+	kct.rotate(token2)
+	if _, err := client.ParcelByID(parcelID); err != nil {
+		t.Fatalf("parcelByID after rotation err: %v", err)
+	}
+	wantKeys := []string{"ShippoToken " + token1, "ShippoToken " + token2}
+	if got := kct.keys(); len(got) != 2 || got[0] != wantKeys[0] || got[1] != wantKeys[1] {
+		t.Errorf("gotKeys=%q wantKeys=%q", got, wantKeys)
+	}
+
+	// A key that the backend rejects
+	// despite refreshing is retried once.
+	kct.rotate("token-3")
+	if _, err := client.ParcelByID(parcelID); err == nil {
+		t.Error("expected a non-nil error")
+	}
+	if got := kct.keys(); len(got) != 1 {
+		t.Errorf("gotRequests=%d wantRequests=1 since the key did not change", len(got))
+	}
+}
+
+func TestFileTokenSourceConcurrentRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "shippo-key")
+	writeKey(t, path, "key-0")
+
+	// The backend accepts the current and the previous keys, as the
+	// old key is only revoked once the new one was rolled out.
+	var mu sync.Mutex
+	accepted := []string{"key-0"}
+	rt := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, key := range accepted {
+			if req.Header.Get("Authorization") == "ShippoToken "+key {
+				return respFromFile("./testdata/parcel-1.json")
+			}
+		}
+		return makeResp("401 Unauthorized", http.StatusUnauthorized), nil
+	})
+
+	fts, err := goshippo.NewFileTokenSource(path, time.Hour)
+	if err != nil {
+		t.Fatalf("newFileTokenSource err: %v", err)
+	}
+	client, err := goshippo.New(goshippo.WithTokenSource(fts), goshippo.WithHTTPRoundTripper(rt))
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+
+	const nWorkers, nCalls, nRotations = 8, 25, 5
+	var wg sync.WaitGroup
+	for i := 0; i < nWorkers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < nCalls; j++ {
+				if _, err := client.ParcelByID("adcfdddf8ec64b84ad22772bce3ea37a"); err != nil {
+					t.Errorf("worker #%d call #%d: %v", i, j, err)
+					return
+				}
+			}
+		}(i)
+	}
+
+	for i := 1; i <= nRotations; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		mu.Lock()
+		accepted = []string{key, accepted[0]}
+		mu.Unlock()
+
+		// Swap the file in atomically, as secret managers do.
+		tmp := filepath.Join(dir, key)
+		writeKey(t, tmp, key)
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatalf("rename err: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	wg.Wait()
+
+	if _, err := client.ParcelByID("adcfdddf8ec64b84ad22772bce3ea37a"); err != nil {
+		t.Fatalf("parcelByID after the rotations err: %v", err)
+	}
+	// The key in use must be one of those still accepted.
+	got, err := fts.Token(context.Background())
+	if err != nil || (got != accepted[0] && got != accepted[1]) {
+		t.Errorf("gotToken=%q gotErr=%v wantToken in %q", got, err, accepted)
+	}
+}
+
+func TestFileTokenSourcePolling(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shippo-key")
+	writeKey(t, path, token1)
+
+	fts, err := goshippo.NewFileTokenSource(path, time.Millisecond)
+	if err != nil {
+		t.Fatalf("newFileTokenSource err: %v", err)
+	}
+	ctx := context.Background()
+	if got, _ := fts.Token(ctx); got != token1 {
+		t.Errorf("gotToken=%q wantToken=%q", got, token1)
+	}
+
+	writeKey(t, path, "rotated-"+token2)
+	time.Sleep(5 * time.Millisecond)
+	if got, _ := fts.Token(ctx); got != "rotated-"+token2 {
+		t.Errorf("gotToken=%q wantToken=%q", got, "rotated-"+token2)
+	}
+
+	// The last good key is kept while the file is missing.
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("remove err: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if got, err := fts.Token(ctx); err != nil || got != "rotated-"+token2 {
+		t.Errorf("gotToken=%q gotErr=%v wantToken=%q", got, err, "rotated-"+token2)
+	}
+
+	writeKey(t, path, "  ")
+	if err := fts.Refresh(ctx); err == nil {
+		t.Error("expected an error for a blank key")
+	}
+	if _, err := goshippo.NewFileTokenSource(path, 0); err == nil {
+		t.Error("expected an error for a blank key file")
+	}
+}
+
+func TestEnvTokenSource(t *testing.T) {
+	t.Setenv("SHIPPO_ROTATED_KEY", token1)
+	kct := &keyCheckingTransport{key: token1}
+	client, err := goshippo.New(goshippo.WithTokenSource(goshippo.EnvTokenSource("SHIPPO_ROTATED_KEY")), goshippo.WithHTTPRoundTripper(kct))
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+
+	const parcelID = "adcfdddf8ec64b84ad22772bce3ea37a"
+	if _, err := client.ParcelByID(parcelID); err != nil {
+		t.Fatalf("parcelByID err: %v", err)
+	}
+	t.Setenv("SHIPPO_ROTATED_KEY", token2)
+	kct.rotate(token2)
+	if _, err := client.ParcelByID(parcelID); err != nil {
+		t.Fatalf("parcelByID err: %v", err)
+	}
+
+	t.Setenv("SHIPPO_ROTATED_KEY", "")
+	if _, err := client.ParcelByID(parcelID); err == nil {
+		t.Error("expected an error for a blank environment variable")
+	}
+}
+
+func TestSetAPIKeyConcurrently(t *testing.T) {
+	client, err := goshippo.NewClient(token1)
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	if err := client.SetTokenSource(nil); err == nil {
+		t.Error("expected an error for a nil TokenSource")
+	}
+	client.SetHTTPRoundTripper(&backend{route: createParcelRoute})
+	parcel := &goshippo.Parcel{
+		Length: 10.3, Width: 12.0, Height: 25, Weight: 99.2,
+		DistanceUnit: goshippo.DistanceYard, MassUnit: goshippo.MassKilogram,
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			client.SetAPIKey(token2)
+			client.SetTokenSource(goshippo.StaticTokenSource(token1))
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := client.CreateParcel(parcel); err != nil {
+				t.Errorf("createParcel err: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,271 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+)
+
+// Every public Client method starts a span named "goshippo.(*Client).<Method>"
+// and records the measures below. Spans are only exported if sampled and
+// measures are only aggregated for registered views. Calls whose span
+// isn't sampled skip their attributes, and without any views they skip
+// the tags and measures too. Register AllViews to collect the metrics:
+//
+//	if err := view.Register(goshippo.AllViews...); err != nil {
+//		log.Fatal(err)
+//	}
+var (
+	MLatencyMs = stats.Float64("github.com/orijtech/goshippo/latency", "The latency of calls to GoShippo", stats.UnitMilliseconds)
+	MCalls     = stats.Int64("github.com/orijtech/goshippo/calls", "The number of calls to GoShippo", stats.UnitDimensionless)
+	MErrors    = stats.Int64("github.com/orijtech/goshippo/errors", "The number of calls to GoShippo that failed", stats.UnitDimensionless)
+	MRetries   = stats.Int64("github.com/orijtech/goshippo/retries", "The number of retried requests to GoShippo", stats.UnitDimensionless)
+)
+
+var (
+	KeyMethod     = tag.MustNewKey("goshippo_method")
+	KeyObjectType = tag.MustNewKey("goshippo_object_type")
+	KeyStatus     = tag.MustNewKey("goshippo_status")
+
+	// KeyTenant is set to the ID of the Tenant of calls that
+	// have one. It is left out of the views below since there
+	// could be a great many tenants, but custom views can use it.
+	KeyTenant = tag.MustNewKey("goshippo_tenant")
+)
+
+var (
+	LatencyView = &view.View{
+		Name:        "goshippo/latency",
+		Description: "The distribution of the latencies of calls to GoShippo",
+		Measure:     MLatencyMs,
+		TagKeys:     []tag.Key{KeyMethod, KeyObjectType, KeyStatus},
+		Aggregation: view.Distribution(
+			// [0ms, 10ms, 25ms, 50ms, 100ms, 200ms, 400ms, 800ms, 1.5s, 3s, 6s, 12s, 30s]
+			0, 10, 25, 50, 100, 200, 400, 800, 1500, 3000, 6000, 12000, 30000,
+		),
+	}
+
+	CallsView = &view.View{
+		Name:        "goshippo/calls",
+		Description: "The number of calls to GoShippo",
+		Measure:     MCalls,
+		TagKeys:     []tag.Key{KeyMethod, KeyObjectType, KeyStatus},
+		Aggregation: view.Count(),
+	}
+
+	ErrorsView = &view.View{
+		Name:        "goshippo/errors",
+		Description: "The number of calls to GoShippo that failed",
+		Measure:     MErrors,
+		TagKeys:     []tag.Key{KeyMethod, KeyObjectType, KeyStatus},
+		Aggregation: view.Count(),
+	}
+
+	RetriesView = &view.View{
+		Name:        "goshippo/retries",
+		Description: "The number of retried requests to GoShippo",
+		Measure:     MRetries,
+		TagKeys:     []tag.Key{KeyMethod, KeyObjectType},
+		Aggregation: view.Count(),
+	}
+
+	AllViews = []*view.View{LatencyView, CallsView, ErrorsView, RetriesView}
+)
+
+// opStats accumulates what the request path learns about
+// a single public method call, for its span and measures.
+type opStats struct {
+	mu         sync.Mutex
+	endpoint   string
+	statusCode int
+	retries    int
+}
+
+type opStatsCtxKey struct{}
+
+func opStatsFromContext(ctx context.Context) *opStats {
+	ops, _ := ctx.Value(opStatsCtxKey{}).(*opStats)
+	return ops
+}
+
+// recordEndpoint records the method and path of the
+// request, the last one for calls that make several.
+func (ops *opStats) recordEndpoint(req *http.Request) {
+	if ops == nil {
+		return
+	}
+	ops.mu.Lock()
+	ops.endpoint = req.Method + " " + req.URL.Path
+	ops.mu.Unlock()
+}
+
+func (ops *opStats) recordStatus(statusCode int) {
+	if ops == nil {
+		return
+	}
+	ops.mu.Lock()
+	ops.statusCode = statusCode
+	ops.mu.Unlock()
+}
+
+func (ops *opStats) recordRetry() {
+	if ops == nil {
+		return
+	}
+	ops.mu.Lock()
+	ops.retries += 1
+	ops.mu.Unlock()
+}
+
+// startOp starts the span and measurements for the public
+// method named method that operates on objectType objects.
+// The returned function must be invoked with the method's
+// error when it returns.
+func startOp(ctx context.Context, method string, objectType EndpointClass) (context.Context, func(error)) {
+	// The children of unsampled spans are never sampled either.
+	var span *trace.Span
+	if parent := trace.FromContext(ctx); parent == nil || parent.SpanContext().IsSampled() {
+		ctx, span = trace.StartSpan(ctx, "goshippo.(*Client)."+method, trace.WithSpanKind(trace.SpanKindClient))
+	}
+	tracing := span != nil && span.IsRecordingEvents()
+	if !tracing && !measuring() {
+		return ctx, func(error) {
+			if span != nil {
+				span.End()
+			}
+		}
+	}
+
+	ops := new(opStats)
+	ctx = context.WithValue(ctx, opStatsCtxKey{}, ops)
+	startTime := time.Now()
+
+	return ctx, func(err error) {
+		ops.mu.Lock()
+		endpoint, statusCode, retries := ops.endpoint, ops.statusCode, ops.retries
+		ops.mu.Unlock()
+
+		tenant := tenantID(ctx)
+		if tracing {
+			span.AddAttributes(
+				trace.StringAttribute("goshippo.endpoint", endpoint),
+				trace.StringAttribute("goshippo.object_type", string(objectType)),
+				trace.Int64Attribute("http.status_code", int64(statusCode)),
+				trace.Int64Attribute("goshippo.retries", int64(retries)),
+			)
+			if tenant != "" {
+				span.AddAttributes(trace.StringAttribute("goshippo.tenant", tenant))
+			}
+			if err != nil {
+				span.SetStatus(trace.Status{Code: traceStatusCode(statusCode, err), Message: err.Error()})
+			}
+		}
+		if span != nil {
+			span.End()
+		}
+
+		mutators := []tag.Mutator{
+			tag.Upsert(KeyMethod, method),
+			tag.Upsert(KeyObjectType, string(objectType)),
+			tag.Upsert(KeyStatus, statusTag(statusCode, err)),
+		}
+		if tenant != "" {
+			mutators = append(mutators, tag.Upsert(KeyTenant, tenant))
+		}
+		measurements := []stats.Measurement{
+			MLatencyMs.M(float64(time.Since(startTime)) / float64(time.Millisecond)),
+			MCalls.M(1),
+		}
+		if err != nil {
+			measurements = append(measurements, MErrors.M(1))
+		}
+		if retries > 0 {
+			measurements = append(measurements, MRetries.M(int64(retries)))
+		}
+		_ = stats.RecordWithTags(ctx, mutators, measurements...)
+	}
+}
+
+// subscriptionProbe is a stats.Recorder that only notes that it
+// was invoked, which the stats package only does for measurements
+// that at least one registered view aggregates.
+type subscriptionProbe bool
+
+func (sp *subscriptionProbe) Record(*tag.Map, interface{}, map[string]interface{}) {
+	*sp = true
+}
+
+// measuring reports whether any registered view, ours or
+// a custom one, aggregates the measures of this package.
+func measuring() bool {
+	probe := new(subscriptionProbe)
+	_ = stats.RecordWithOptions(context.Background(),
+		stats.WithRecorder(probe),
+		stats.WithMeasurements(MLatencyMs.M(0), MCalls.M(0), MErrors.M(0), MRetries.M(0)),
+	)
+	return bool(*probe)
+}
+
+func statusTag(statusCode int, err error) string {
+	switch {
+	case statusCode > 0:
+		return strconv.Itoa(statusCode)
+	case err == nil:
+		return "OK"
+	case errors.Is(err, context.Canceled):
+		return "CANCELLED"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "DEADLINE_EXCEEDED"
+	default:
+		return "ERROR"
+	}
+}
+
+func traceStatusCode(statusCode int, err error) int32 {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return trace.StatusCodeCancelled
+	case errors.Is(err, context.DeadlineExceeded):
+		return trace.StatusCodeDeadlineExceeded
+	}
+	switch statusCode {
+	case 400, 422:
+		return trace.StatusCodeInvalidArgument
+	case 401:
+		return trace.StatusCodeUnauthenticated
+	case 403:
+		return trace.StatusCodePermissionDenied
+	case 404:
+		return trace.StatusCodeNotFound
+	case 429:
+		return trace.StatusCodeResourceExhausted
+	case 502, 503, 504:
+		return trace.StatusCodeUnavailable
+	}
+	if statusCode >= 500 {
+		return trace.StatusCodeInternal
+	}
+	return trace.StatusCodeUnknown
+}
@@ -0,0 +1,190 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/trace"
+
+	"github.com/orijtech/goshippo/v1"
+)
+
+// spanRecorder is a trace.Exporter that keeps the spans it exports.
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*trace.SpanData
+}
+
+func (sr *spanRecorder) ExportSpan(sd *trace.SpanData) {
+	sr.mu.Lock()
+	sr.spans = append(sr.spans, sd)
+	sr.mu.Unlock()
+}
+
+func (sr *spanRecorder) span(name string) *trace.SpanData {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	for _, sd := range sr.spans {
+		if sd.Name == name {
+			return sd
+		}
+	}
+	return nil
+}
+
+func tracingClient(t *testing.T) *goshippo.Client {
+	client, err := goshippo.New(
+		goshippo.WithAPIKey(token1),
+		goshippo.WithHTTPRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if strings.Contains(req.URL.Path, "missing") {
+				return makeResp("404 Not Found", http.StatusNotFound), nil
+			}
+			return respFromFile("./testdata/parcel-1.json")
+		})),
+	)
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	return client
+}
+
+func TestSpanAttributes(t *testing.T) {
+	recorder := new(spanRecorder)
+	trace.RegisterExporter(recorder)
+	defer trace.UnregisterExporter(recorder)
+
+	client := tracingClient(t)
+	ctx, parent := trace.StartSpan(context.Background(), "fulfil", trace.WithSampler(trace.AlwaysSample()))
+	if _, err := client.ParcelByIDContext(ctx, "adcfdddf8ec64b84ad22772bce3ea37a"); err != nil {
+		t.Fatalf("parcelByID err: %v", err)
+	}
+	if _, err := client.ParcelByIDContext(goshippo.WithTenant(ctx, goshippo.Tenant{ID: "merchant-7"}), "missing"); err == nil {
+		t.Fatal("expected an error for a missing parcel")
+	}
+	parent.End()
+
+	sd := recorder.span("goshippo.(*Client).ParcelByID")
+	if sd == nil {
+		t.Fatal("no span was exported for ParcelByID")
+	}
+	if got, want := sd.ParentSpanID, parent.SpanContext().SpanID; got != want {
+		t.Errorf("gotParent=%v wantParent=%v", got, want)
+	}
+	want := map[string]interface{}{
+		"goshippo.endpoint":    "GET /parcels/adcfdddf8ec64b84ad22772bce3ea37a/",
+		"goshippo.object_type": "parcels",
+		"http.status_code":     int64(200),
+		"goshippo.retries":     int64(0),
+	}
+	for key, wantValue := range want {
+		if got := sd.Attributes[key]; got != wantValue {
+			t.Errorf("%s: got=%v want=%v", key, got, wantValue)
+		}
+	}
+
+	// Spans are exported as they end: the failed call just before the parent.
+	recorder.mu.Lock()
+	failed := recorder.spans[len(recorder.spans)-2]
+	recorder.mu.Unlock()
+	if got, want := failed.Attributes["goshippo.tenant"], "merchant-7"; got != want {
+		t.Errorf("gotTenant=%v wantTenant=%v", got, want)
+	}
+	if got, want := failed.Status.Code, int32(trace.StatusCodeNotFound); got != want {
+		t.Errorf("gotStatus=%d wantStatus=%d", got, want)
+	}
+}
+
+func TestUnsampledCallsExportNothing(t *testing.T) {
+	recorder := new(spanRecorder)
+	trace.RegisterExporter(recorder)
+	defer trace.UnregisterExporter(recorder)
+
+	client := tracingClient(t)
+	ctx, parent := trace.StartSpan(context.Background(), "fulfil", trace.WithSampler(trace.NeverSample()))
+	if _, err := client.ParcelByIDContext(ctx, "adcfdddf8ec64b84ad22772bce3ea37a"); err != nil {
+		t.Fatalf("parcelByID err: %v", err)
+	}
+	parent.End()
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.spans) != 0 {
+		t.Errorf("got %d exported spans, want none", len(recorder.spans))
+	}
+}
+
+func TestRecordedViews(t *testing.T) {
+	if err := view.Register(goshippo.CallsView, goshippo.ErrorsView); err != nil {
+		t.Fatalf("register err: %v", err)
+	}
+	defer view.Unregister(goshippo.CallsView, goshippo.ErrorsView)
+
+	client := tracingClient(t)
+	for i := 0; i < 3; i++ {
+		if _, err := client.ParcelByID("adcfdddf8ec64b84ad22772bce3ea37a"); err != nil {
+			t.Fatalf("#%d: parcelByID err: %v", i, err)
+		}
+	}
+	if _, err := client.ParcelByID("missing"); err == nil {
+		t.Fatal("expected an error for a missing parcel")
+	}
+
+	tests := [...]struct {
+		view      *view.View
+		wantCount map[string]int64
+	}{
+		0: {view: goshippo.CallsView, wantCount: map[string]int64{"200": 3, "404": 1}},
+		1: {view: goshippo.ErrorsView, wantCount: map[string]int64{"404": 1}},
+	}
+
+	for i, tt := range tests {
+		rows, err := view.RetrieveData(tt.view.Name)
+		if err != nil {
+			t.Errorf("#%d: retrieveData err: %v", i, err)
+			continue
+		}
+		gotCount := make(map[string]int64)
+		for _, row := range rows {
+			var method, status string
+			for _, tg := range row.Tags {
+				switch tg.Key {
+				case goshippo.KeyMethod:
+					method = tg.Value
+				case goshippo.KeyStatus:
+					status = tg.Value
+				}
+			}
+			if method != "ParcelByID" {
+				t.Errorf("#%d: gotMethod=%q wantMethod=%q", i, method, "ParcelByID")
+			}
+			gotCount[status] += row.Data.(*view.CountData).Value
+		}
+		for status, want := range tt.wantCount {
+			if got := gotCount[status]; got != want {
+				t.Errorf("#%d: status %s: gotCount=%d wantCount=%d", i, status, got, want)
+			}
+		}
+		if len(gotCount) != len(tt.wantCount) {
+			t.Errorf("#%d: gotCount=%v wantCount=%v", i, gotCount, tt.wantCount)
+		}
+	}
+}
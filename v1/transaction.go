@@ -0,0 +1,215 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Transaction is the purchase of a shipping label for a Rate.
+type Transaction struct {
+	// Rate is the ID of the Rate to purchase
+	// a label for. It is required for purchases.
+	Rate string `json:"rate"`
+
+	// LabelFileType is the format of the label e.g "PDF" or "PNG".
+	// If unset, the default format of the account is used.
+	LabelFileType LabelFileType `json:"label_file_type,omitempty"`
+
+	// Async if set makes the backend return immediately, with
+	// a QUEUED Status, instead of waiting for the carrier.
+	Async bool `json:"async"`
+
+	// Metadata is an optional string of upto 100 characters
+	// that can be filled with any additional information
+	// that you want to attach to the object.
+	Metadata string `json:"metadata,omitempty"`
+
+	// ID is an output only variable created by GoShippo's
+	// backend, for the given Transaction.
+	ID string `json:"object_id,omitempty"`
+
+	// OwnerUsername is the username of
+	// the user who created the Transaction.
+	OwnerUsername string `json:"object_owner,omitempty"`
+
+	// CreatedAt is an output only variable that
+	// records when this Transaction was created.
+	CreatedAt *time.Time `json:"object_created,omitempty"`
+
+	// UpdatedAt is an output only variable that
+	// records when this Transaction was last updated.
+	UpdatedAt *time.Time `json:"object_updated,omitempty"`
+
+	// State is an output only variable that is either "VALID" or "INVALID".
+	State string `json:"object_state,omitempty"`
+
+	// Status is the output only purchase status e.g "QUEUED" or "SUCCESS".
+	Status TransactionStatus `json:"status,omitempty"`
+
+	// TrackingNumber is set by the carrier once the label is purchased.
+	TrackingNumber string `json:"tracking_number,omitempty"`
+
+	// TrackingURLProvider is the carrier's page for TrackingNumber.
+	TrackingURLProvider string `json:"tracking_url_provider,omitempty"`
+
+	// LabelURL is the URL of the purchased label.
+	LabelURL string `json:"label_url,omitempty"`
+
+	// CommercialInvoiceURL is the URL of the commercial
+	// invoice, for international shipments.
+	CommercialInvoiceURL string `json:"commercial_invoice_url,omitempty"`
+
+	// Messages contains the errors and warnings from the carrier.
+	Messages []*ValidationMessage `json:"messages,omitempty"`
+
+	// InTestMode indicates whether the
+	// object has been created in test mode.
+	InTestMode bool `json:"test"`
+}
+
+type TransactionStatus string
+
+const (
+	TransactionWaiting        TransactionStatus = "WAITING"
+	TransactionQueued         TransactionStatus = "QUEUED"
+	TransactionSuccess        TransactionStatus = "SUCCESS"
+	TransactionError          TransactionStatus = "ERROR"
+	TransactionRefunded       TransactionStatus = "REFUNDED"
+	TransactionRefundPending  TransactionStatus = "REFUNDPENDING"
+	TransactionRefundRejected TransactionStatus = "REFUNDREJECTED"
+)
+
+type LabelFileType string
+
+const (
+	LabelPNG       LabelFileType = "PNG"
+	LabelPNG2x3    LabelFileType = "PNG_2.3x7.5"
+	LabelPDF       LabelFileType = "PDF"
+	LabelPDF2x3    LabelFileType = "PDF_2.3x7.5"
+	LabelPDF4x6    LabelFileType = "PDF_4x6"
+	LabelPDF4x8    LabelFileType = "PDF_4x8"
+	LabelPDFA4     LabelFileType = "PDF_A4"
+	LabelPDFA6     LabelFileType = "PDF_A6"
+	LabelZPLII     LabelFileType = "ZPLII"
+	LabelUndefined LabelFileType = ""
+)
+
+var (
+	errBlankRate = errors.New("expecting a non-blank rate")
+
+	errEmptyTransactionID = errors.New("expecting a non-empty transactionID")
+
+	errBlankTransactionFromServer = errors.New("got back a blank transaction from the server")
+)
+
+func (t *Transaction) Validate() error {
+	if t == nil || strings.TrimSpace(t.Rate) == "" {
+		return errBlankRate
+	}
+	return nil
+}
+
+// CreateTransaction purchases the label for the Rate in t.
+func (c *Client) CreateTransaction(t *Transaction) (*Transaction, error) {
+	return c.CreateTransactionContext(context.Background(), t)
+}
+
+func (c *Client) CreateTransactionContext(ctx context.Context, t *Transaction) (_ *Transaction, err error) {
+	ctx, endOp := startOp(ctx, "CreateTransaction", EndpointTransactions)
+	defer func() { endOp(err) }()
+
+	return invoke(c, ctx, &Operation{Name: "CreateTransaction", Class: EndpointTransactions, Request: t}, func(ctx context.Context) (*Transaction, error) {
+		if err := t.Validate(); err != nil {
+			return nil, err
+		}
+		if err := c.checkSameMode(ctx, t.Rate); err != nil {
+			return nil, err
+		}
+
+		key, replayedID, err := c.replayedID(ctx, EndpointTransactions)
+		if err != nil {
+			return nil, err
+		}
+		if replayedID != "" {
+			return c.TransactionByIDContext(ctx, replayedID)
+		}
+
+		blob, err := json.Marshal(t)
+		if err != nil {
+			return nil, err
+		}
+		fullURL := fmt.Sprintf("%s/transactions/", c.baseURL())
+		req, err := http.NewRequestWithContext(ctx, "POST", fullURL, bytes.NewReader(blob))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(idempotencyKeyHeader, key)
+
+		recvTransaction, err := c.doReqAndTransaction(req)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.recordCreated(ctx, EndpointTransactions, key, recvTransaction.ID); err != nil {
+			return recvTransaction, err
+		}
+		return recvTransaction, nil
+	})
+}
+
+func (c *Client) TransactionByID(transactionID string) (*Transaction, error) {
+	return c.TransactionByIDContext(context.Background(), transactionID)
+}
+
+func (c *Client) TransactionByIDContext(ctx context.Context, transactionID string) (_ *Transaction, err error) {
+	ctx, endOp := startOp(ctx, "TransactionByID", EndpointTransactions)
+	defer func() { endOp(err) }()
+
+	return invoke(c, ctx, &Operation{Name: "TransactionByID", Class: EndpointTransactions, Request: transactionID}, func(ctx context.Context) (*Transaction, error) {
+		transactionID = strings.TrimSpace(transactionID)
+		if transactionID == "" {
+			return nil, errEmptyTransactionID
+		}
+		fullURL := fmt.Sprintf("%s/transactions/%s/", c.baseURL(), transactionID)
+		req, err := http.NewRequestWithContext(ctx, "GET", fullURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		return c.doReqAndTransaction(req)
+	})
+}
+
+func (c *Client) doReqAndTransaction(req *http.Request) (*Transaction, error) {
+	recvTransaction := new(Transaction)
+	if _, err := c.doAuthAndReq(req, recvTransaction); err != nil {
+		return nil, err
+	}
+	if recvTransaction.ID == "" {
+		return nil, errBlankTransactionFromServer
+	}
+	// Labels are purchased for Rates of the same mode.
+	mode := modeOfTestFlag(recvTransaction.InTestMode)
+	c.RecordObjectMode(recvTransaction.ID, mode)
+	c.RecordObjectMode(recvTransaction.Rate, mode)
+	return recvTransaction, nil
+}
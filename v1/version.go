@@ -0,0 +1,74 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo
+
+import "strings"
+
+// APIVersion is a GoShippo API version, sent in
+// the Shippo-API-Version header e.g "2018-02-08".
+type APIVersion string
+
+const (
+	APIVersion20140211 APIVersion = "2014-02-11"
+	APIVersion20161025 APIVersion = "2016-10-25"
+	APIVersion20170329 APIVersion = "2017-03-29"
+	APIVersion20170801 APIVersion = "2017-08-01"
+	APIVersion20180208 APIVersion = "2018-02-08"
+
+	// APIVersionUnpinned means that no Shippo-API-Version header
+	// is sent, so the backend uses the version that the account
+	// defaults to. Objects are then treated as legacy ones.
+	APIVersionUnpinned APIVersion = ""
+
+	// APIVersionLatest is the most recent version that
+	// this package knows about.
+	APIVersionLatest = APIVersion20180208
+)
+
+// Pinned reports whether v is sent to the backend in requests.
+func (v APIVersion) Pinned() bool {
+	return strings.TrimSpace(string(v)) != ""
+}
+
+// Before reports whether v precedes other. APIVersions
+// are dates, so they compare lexicographically.
+func (v APIVersion) Before(other APIVersion) bool {
+	return string(v) < string(other)
+}
+
+// usesObjectPurpose reports whether objects created in version
+// v require an object_purpose. The field was dropped in 2017-03-29
+// so only unpinned clients and those pinned to older versions use it.
+func (v APIVersion) usesObjectPurpose() bool {
+	return !v.Pinned() || v.Before(APIVersion20170329)
+}
+
+// SetAPIVersion pins the version sent in the Shippo-API-Version
+// header. Models sent and received by the client adapt to it e.g
+// object_purpose is neither required nor sent from 2017-03-29 on.
+func (c *Client) SetAPIVersion(version APIVersion) {
+	c.mu.Lock()
+	c.apiVersion = APIVersion(strings.TrimSpace(string(version)))
+	c.mu.Unlock()
+}
+
+// APIVersion returns the version that the client is pinned to,
+// or APIVersionUnpinned if it uses the account's default version.
+func (c *Client) APIVersion() APIVersion {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.apiVersion
+}
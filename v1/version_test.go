@@ -0,0 +1,78 @@
+// Copyright 2017 orijtech. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goshippo_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/orijtech/goshippo/v1"
+)
+
+func TestAPIVersionPinning(t *testing.T) {
+	tests := [...]struct {
+		version     goshippo.APIVersion
+		addr        *goshippo.Address
+		wantErr     bool
+		wantPurpose bool
+	}{
+		0: {version: goshippo.APIVersionUnpinned, addr: &goshippo.Address{Country: "US"}, wantErr: true},
+		1: {version: goshippo.APIVersionUnpinned, addr: &goshippo.Address{Purpose: "QUOTE"}, wantPurpose: true},
+		2: {version: goshippo.APIVersion20161025, addr: &goshippo.Address{Purpose: "QUOTE"}, wantPurpose: true},
+		3: {version: goshippo.APIVersion20180208, addr: &goshippo.Address{Purpose: "QUOTE"}, wantErr: true},
+		4: {version: goshippo.APIVersion20180208, addr: &goshippo.Address{Purpose: "QUOTE", Country: "US"}},
+		5: {version: goshippo.APIVersionLatest, addr: &goshippo.Address{Country: "US"}},
+	}
+
+	for i, tt := range tests {
+		client, err := goshippo.NewClient(token1)
+		if err != nil {
+			t.Fatalf("#%d: client err: %v", i, err)
+		}
+		client.SetAPIVersion(tt.version)
+
+		var gotBody []byte
+		var gotVersion string
+		be := &backend{route: createAddressRoute}
+		client.SetHTTPRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			gotBody, _ = ioutil.ReadAll(req.Body)
+			gotVersion = req.Header.Get("Shippo-API-Version")
+			req.Body = ioutil.NopCloser(bytes.NewReader(gotBody))
+			return be.RoundTrip(req)
+		}))
+
+		_, err = client.CreateAddress(tt.addr)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("#%d: want non-nil error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: gotErr=%v", i, err)
+			continue
+		}
+
+		if got, want := gotVersion, string(tt.version); got != want {
+			t.Errorf("#%d: gotVersionHeader=%q wantVersionHeader=%q", i, got, want)
+		}
+		if got, want := strings.Contains(string(gotBody), "object_purpose"), tt.wantPurpose; got != want {
+			t.Errorf("#%d: object_purpose sent=%v want=%v; body=%s", i, got, want, gotBody)
+		}
+	}
+}